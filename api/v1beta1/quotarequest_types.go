@@ -0,0 +1,97 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuotaRequestSpec defines the desired state of QuotaRequest
+type QuotaRequestSpec struct {
+	// Hard is the set of requested hard limits for the managed resource quota of the namespace of the QuotaRequest.
+	// Resources not listed here are not changed.
+	Hard corev1.ResourceList `json:"hard"`
+}
+
+// QuotaRequestPhase is the progress of a QuotaRequest.
+// +kubebuilder:validation:Enum=Pending;Applied;Denied
+type QuotaRequestPhase string
+
+const (
+	QuotaRequestPending QuotaRequestPhase = "Pending"
+	QuotaRequestApplied QuotaRequestPhase = "Applied"
+	QuotaRequestDenied  QuotaRequestPhase = "Denied"
+)
+
+// QuotaRequestStatus defines the observed state of QuotaRequest
+type QuotaRequestStatus struct {
+	// Phase is the progress of the request.
+	// Pending requests wait for approval, and Applied and Denied requests are not processed anymore.
+	// +optional
+	Phase QuotaRequestPhase `json:"phase,omitempty"`
+
+	// Tenant is the name of the tenant resource quota of the namespace.
+	// +optional
+	Tenant string `json:"tenant,omitempty"`
+
+	// Message is a human readable description of the phase.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Conditions represent the latest available observations of the request.
+	// An administrator of the tenant approves or rejects the request by setting the Approved condition to True or False.
+	// The Approved condition is ignored unless its observedGeneration is the generation of the request.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types of QuotaRequest.
+const (
+	// ConditionApproved is true when the request is approved automatically or by an administrator of the tenant,
+	// and false when the request is rejected.
+	ConditionApproved = "Approved"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+
+// QuotaRequest is the Schema for the quotarequests API.
+// It requests new hard limits for a namespace without permissions to edit resource quotas.
+type QuotaRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuotaRequestSpec   `json:"spec,omitempty"`
+	Status QuotaRequestStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// QuotaRequestList contains a list of QuotaRequest
+type QuotaRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuotaRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuotaRequest{}, &QuotaRequestList{})
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuotaTransferSpec defines the desired state of QuotaTransfer
+type QuotaTransferSpec struct {
+	// To is the namespace receiving the resources.
+	// It must belong to the same tenant as the namespace of the QuotaTransfer.
+	// +kubebuilder:validation:MinLength=1
+	To string `json:"to"`
+
+	// Resources is the set of hard limits moved from the managed resource quota of the namespace of the QuotaTransfer
+	// to that of the namespace To.
+	Resources corev1.ResourceList `json:"resources"`
+}
+
+// QuotaTransferPhase is the result of a QuotaTransfer.
+// +kubebuilder:validation:Enum=Succeeded;Failed
+type QuotaTransferPhase string
+
+const (
+	QuotaTransferSucceeded QuotaTransferPhase = "Succeeded"
+	QuotaTransferFailed    QuotaTransferPhase = "Failed"
+)
+
+// QuotaTransferStatus defines the observed state of QuotaTransfer
+type QuotaTransferStatus struct {
+	// Phase is the result of the transfer. It is empty until the transfer is executed.
+	// A QuotaTransfer is executed only once.
+	// +optional
+	Phase QuotaTransferPhase `json:"phase,omitempty"`
+
+	// Tenant is the name of the tenant resource quota of the namespaces.
+	// +optional
+	Tenant string `json:"tenant,omitempty"`
+
+	// Message is a human readable description of the result.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="To",type=string,JSONPath=`.spec.to`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+
+// QuotaTransfer is the Schema for the quotatransfers API.
+// It moves hard limits between the managed resource quotas of two namespaces in the same tenant.
+type QuotaTransfer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuotaTransferSpec   `json:"spec,omitempty"`
+	Status QuotaTransferStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// QuotaTransferList contains a list of QuotaTransfer
+type QuotaTransferList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuotaTransfer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuotaTransfer{}, &QuotaTransferList{})
+}
@@ -17,6 +17,10 @@ limitations under the License.
 package v1beta1
 
 import (
+	"fmt"
+	"time"
+
+	"gopkg.in/inf.v0"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,9 +35,383 @@ type TenantResourceQuotaSpec struct {
 	// +optional
 	Hard corev1.ResourceList `json:"hard,omitempty"`
 
+	// HardPatterns is the set of hard limits for the total of all resources whose names match each pattern,
+	// such as *.storageclass.storage.k8s.io/requests.storage and count/*. Patterns use the syntax of path.Match.
+	// The controller expands each pattern into the matching resources of the resource quotas of namespaces,
+	// and both the hard limits and the hard patterns are enforced.
+	// +optional
+	HardPatterns corev1.ResourceList `json:"hardPatterns,omitempty"`
+
+	// AllocationPolicy decides how the hard limits are divided among the namespaces of the tenant.
+	// Manual leaves the allocation to the administrators of the namespaces.
+	// Dynamic lets the controller compute the hard limits of each namespace from the observed usage and the namespace weights.
+	// Defaults to Manual.
+	// +optional
+	AllocationPolicy AllocationPolicy `json:"allocationPolicy,omitempty"`
+
+	// NamespaceWeights is the weight of each namespace used to share the hard limits not used by any namespace
+	// under the Dynamic allocation policy. Namespaces not listed here have weight 1.
+	// +optional
+	NamespaceWeights map[string]int32 `json:"namespaceWeights,omitempty"`
+
+	// NamespaceDefaults is the set of hard limits granted to a namespace when it is newly selected.
+	// Resources without defaults are set to zero. A default is not granted if it does not fit in the hard limits.
+	// +optional
+	NamespaceDefaults corev1.ResourceList `json:"namespaceDefaults,omitempty"`
+
+	// NamespaceLimits is the range of hard limits allowed for each namespace in the tenant.
+	// +optional
+	NamespaceLimits *NamespaceLimits `json:"namespaceLimits,omitempty"`
+
 	// NamespaceSelector is used to select namespaces by label.
 	// +optional
 	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Overcommit is the percentage of the hard limits allowed to be allocated to namespaces for each resource.
+	// For example, 150 allows the sum of allocations up to 1.5 times the hard limit.
+	// Resources without overcommit can be allocated up to the hard limits.
+	// +optional
+	Overcommit map[corev1.ResourceName]int32 `json:"overcommit,omitempty"`
+
+	// UsageGuard reports the tenant whose usage approaches the hard limits.
+	// +optional
+	UsageGuard *UsageGuard `json:"usageGuard,omitempty"`
+
+	// EnforceUsage denies creating pods and persistent volume claims that make the observed usage of the tenant exceed the hard limits.
+	// It keeps tenants with overcommitted allocations within the hard limits.
+	// +optional
+	EnforceUsage bool `json:"enforceUsage,omitempty"`
+
+	// AutoApprove is the set of the maximum increase of hard limits approved automatically for a QuotaRequest.
+	// A QuotaRequest raising a resource by more than this, or raising a resource not listed here,
+	// waits for an administrator of the tenant to approve it.
+	// +optional
+	AutoApprove corev1.ResourceList `json:"autoApprove,omitempty"`
+
+	// Reclaim shrinks the allocations of namespaces that leave them unused for a while.
+	// Reclamation is disabled if not set.
+	// +optional
+	Reclaim *ReclaimPolicy `json:"reclaim,omitempty"`
+
+	// FieldOwnership decides how the controller treats the hard limits of the managed resource quotas set by other field managers.
+	// Respect keeps them as pinned values, and TakeOver overwrites them and takes the ownership.
+	// Reject denies changes of the hard limits by field managers other than the controller and ApprovedFieldManagers,
+	// and takes over the hard limits set by the others.
+	// Defaults to Respect.
+	// +optional
+	FieldOwnership FieldOwnershipPolicy `json:"fieldOwnership,omitempty"`
+
+	// ApprovedFieldManagers is the list of field managers allowed to change the hard limits of the managed resource quotas
+	// under the Reject field ownership policy. The hard limits set by them are kept as pinned values.
+	// +optional
+	ApprovedFieldManagers []string `json:"approvedFieldManagers,omitempty"`
+
+	// MissingResourceGracePeriod is how long resource quotas can omit a resource of the hard limits
+	// after it is found missing in the status. The admission webhook allows changes of resource quotas lacking it
+	// with a warning during the period, and the controller backfills it.
+	// Resource quotas lacking a resource of the hard limits are denied if not set.
+	// +optional
+	MissingResourceGracePeriod *metav1.Duration `json:"missingResourceGracePeriod,omitempty"`
+
+	// EnforcementMode decides how the admission webhook treats changes of resource quotas exceeding the hard limits of the tenant.
+	// Enforce denies them, Warn allows them with admission warnings,
+	// and DryRun allows them and records them in the status and the metrics.
+	// The same mode applies to pods and persistent volume claims denied by EnforceUsage,
+	// whose violations are recorded only in the metrics in the DryRun mode.
+	// Defaults to Enforce.
+	// +optional
+	EnforcementMode EnforcementMode `json:"enforcementMode,omitempty"`
+
+	// Priority decides the owner of a namespace selected by multiple tenants.
+	// The tenant with the highest priority owns the namespace,
+	// and the tenant with the lexicographically smallest name wins a tie.
+	// The admission webhook allows tenants to select the same namespaces only if their priorities differ.
+	// A tenant taking over a namespace keeps the hard limits of its resource quota within its remaining resources,
+	// and tenants being deleted do not own namespaces.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// Parent is the name of the parent TenantResourceQuota.
+	// Allocations of this tenant are also limited by the hard limits of the parent and its ancestors.
+	// +optional
+	Parent string `json:"parent,omitempty"`
+
+	// ResourceQuotaName is the name of the resource quota managed in each namespace of the tenant.
+	// Defaults to "default". It cannot be changed after creation.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	ResourceQuotaName string `json:"resourceQuotaName,omitempty"`
+
+	// ScopedQuotas is the list of scoped quotas managed in addition to the default resource quota.
+	// A resource quota is created for each entry in every namespace of the tenant.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	ScopedQuotas []ScopedQuota `json:"scopedQuotas,omitempty"`
+
+	// Schedules is the list of time windows replacing the hard limits.
+	// The first schedule whose window is open is effective.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Schedules []QuotaSchedule `json:"schedules,omitempty"`
+
+	// Leases is the list of temporary raises of the hard limits.
+	// Expired leases are reverted by the controller and can be removed from the list.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Leases []QuotaLease `json:"leases,omitempty"`
+}
+
+// AllocationPolicy is the policy to divide the hard limits among namespaces.
+// +kubebuilder:validation:Enum=Manual;Dynamic
+type AllocationPolicy string
+
+const (
+	AllocationManual  AllocationPolicy = "Manual"
+	AllocationDynamic AllocationPolicy = "Dynamic"
+)
+
+// FieldOwnershipPolicy is the policy for the hard limits of managed resource quotas set by other field managers.
+// +kubebuilder:validation:Enum=Respect;TakeOver;Reject
+type FieldOwnershipPolicy string
+
+const (
+	FieldOwnershipRespect  FieldOwnershipPolicy = "Respect"
+	FieldOwnershipTakeOver FieldOwnershipPolicy = "TakeOver"
+	FieldOwnershipReject   FieldOwnershipPolicy = "Reject"
+)
+
+// EnforcementMode is the mode to enforce the hard limits of the tenant on resource quotas.
+// +kubebuilder:validation:Enum=Enforce;Warn;DryRun
+type EnforcementMode string
+
+const (
+	EnforcementEnforce EnforcementMode = "Enforce"
+	EnforcementWarn    EnforcementMode = "Warn"
+	EnforcementDryRun  EnforcementMode = "DryRun"
+)
+
+// Weekday is a day of the week.
+// +kubebuilder:validation:Enum=Sunday;Monday;Tuesday;Wednesday;Thursday;Friday;Saturday
+type Weekday string
+
+// QuotaSchedule replaces hard limits while its time window is open.
+type QuotaSchedule struct {
+	// Name is the name of the schedule.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Days is the list of days of the week when the window opens. Every day if empty.
+	// +optional
+	Days []Weekday `json:"days,omitempty"`
+
+	// Start is the time of day when the window opens, in HH:MM.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+
+	// End is the time of day when the window closes, in HH:MM.
+	// The window closes on the next day if End is not after Start.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	End string `json:"end"`
+
+	// TimeZone is the name of the time zone of Start and End in the IANA time zone database.
+	// Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Hard is the set of hard limits replacing those in the spec while the window is open.
+	// Resources not listed here keep the hard limits in the spec.
+	Hard corev1.ResourceList `json:"hard"`
+}
+
+// Window returns whether the window of the schedule is open at now, and the next time when it opens or closes.
+func (s *QuotaSchedule) Window(now time.Time) (bool, time.Time, error) {
+	loc := time.UTC
+	if s.TimeZone != "" {
+		var err error
+		loc, err = time.LoadLocation(s.TimeZone)
+		if err != nil {
+			return false, time.Time{}, err
+		}
+	}
+	startHour, startMinute, err := parseClock(s.Start)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	endHour, endMinute, err := parseClock(s.End)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	local := now.In(loc)
+	window := func(offset int) (time.Time, time.Time) {
+		opens := time.Date(local.Year(), local.Month(), local.Day()+offset, startHour, startMinute, 0, 0, loc)
+		closes := time.Date(local.Year(), local.Month(), local.Day()+offset, endHour, endMinute, 0, 0, loc)
+		if !closes.After(opens) {
+			closes = closes.AddDate(0, 0, 1)
+		}
+		return opens, closes
+	}
+
+	// A window opened yesterday may still be open.
+	for _, offset := range []int{-1, 0} {
+		opens, closes := window(offset)
+		if s.opensOn(opens.Weekday()) && !now.Before(opens) && now.Before(closes) {
+			return true, closes, nil
+		}
+	}
+	for offset := 0; offset <= 7; offset++ {
+		opens, _ := window(offset)
+		if s.opensOn(opens.Weekday()) && opens.After(now) {
+			return false, opens, nil
+		}
+	}
+	return false, time.Time{}, nil
+}
+
+func (s *QuotaSchedule) opensOn(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if string(d) == day.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func parseClock(clock string) (int, int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q: %w", clock, err)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// QuotaLease raises hard limits until it expires.
+type QuotaLease struct {
+	// Name is the name of the lease.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace is the namespace whose managed resource quota is raised by the lease.
+	// The hard limits of the tenant are raised as well, so that the lease does not take resources from the other namespaces.
+	// If empty, only the hard limits of the tenant are raised.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Hard is the set of hard limits added while the lease is active.
+	Hard corev1.ResourceList `json:"hard"`
+
+	// ExpiresAt is the time when the lease expires.
+	ExpiresAt metav1.Time `json:"expiresAt"`
+}
+
+// IsActive returns true if the lease has not expired at now.
+func (l *QuotaLease) IsActive(now time.Time) bool {
+	return now.Before(l.ExpiresAt.Time)
+}
+
+// UsageGuard is the guard based on the observed usage of the tenant.
+type UsageGuard struct {
+	// ThresholdPercent is the percentage of the hard limits at which the usage is reported.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	ThresholdPercent int32 `json:"thresholdPercent"`
+
+	// BlockRaises denies raising allocations of namespaces while the usage is above the threshold.
+	// +optional
+	BlockRaises bool `json:"blockRaises,omitempty"`
+}
+
+// ReclaimPolicy is the policy to reclaim allocations from idle namespaces.
+type ReclaimPolicy struct {
+	// IdlePeriod is how long an allocation must stay above the usage plus the headroom before it is reclaimed.
+	IdlePeriod metav1.Duration `json:"idlePeriod"`
+
+	// HeadroomPercent is the percentage of the usage left to a namespace in addition to the usage.
+	// For example, 20 shrinks the hard limit of a namespace to 1.2 times its usage.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	HeadroomPercent int32 `json:"headroomPercent,omitempty"`
+}
+
+// Target returns the hard limit left to a namespace using the given quantity.
+func (p *ReclaimPolicy) Target(used resource.Quantity) resource.Quantity {
+	return percentOf(used, 100+p.HeadroomPercent)
+}
+
+// ScopedQuota is a tenant quota applied to the resources matching the scopes.
+type ScopedQuota struct {
+	// Name is the name of the resource quota created in each namespace.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Hard is the set of desired hard limits for the scope in the tenant.
+	// +optional
+	Hard corev1.ResourceList `json:"hard,omitempty"`
+
+	// Scopes is the collection of filters of the resource quota.
+	// +optional
+	Scopes []corev1.ResourceQuotaScope `json:"scopes,omitempty"`
+
+	// ScopeSelector is the collection of filters like scopes that must match each object tracked by the resource quota.
+	// +optional
+	ScopeSelector *corev1.ScopeSelector `json:"scopeSelector,omitempty"`
+}
+
+// NamespaceLimits is the range of hard limits allowed for each namespace.
+type NamespaceLimits struct {
+	// Min is the minimum hard limits of a namespace.
+	// Zero is always allowed so that a namespace can release its allocation.
+	// +optional
+	Min corev1.ResourceList `json:"min,omitempty"`
+
+	// Max is the maximum hard limits of a namespace.
+	// +optional
+	Max corev1.ResourceList `json:"max,omitempty"`
+}
+
+// NamespaceLimitType is the bound of NamespaceLimits.
+// +kubebuilder:validation:Enum=Min;Max
+type NamespaceLimitType string
+
+const (
+	NamespaceLimitMin NamespaceLimitType = "Min"
+	NamespaceLimitMax NamespaceLimitType = "Max"
+)
+
+// NamespaceLimitViolation is a namespace whose allocation is out of NamespaceLimits.
+type NamespaceLimitViolation struct {
+	// Namespace is the name of the namespace.
+	Namespace string `json:"namespace"`
+
+	// Resource is the name of the resource.
+	Resource corev1.ResourceName `json:"resource"`
+
+	// Type is the violated bound.
+	Type NamespaceLimitType `json:"type"`
+
+	// Allocated is the observed allocation of the resource in the namespace.
+	Allocated resource.Quantity `json:"allocated"`
+
+	// Limit is the value of the violated bound.
+	Limit resource.Quantity `json:"limit"`
+}
+
+// NamespaceConflict is a namespace selected by multiple tenants.
+type NamespaceConflict struct {
+	// Namespace is the name of the namespace.
+	Namespace string `json:"namespace"`
+
+	// Tenant is the name of the competing TenantResourceQuota.
+	Tenant string `json:"tenant"`
+
+	// Owner is the name of the TenantResourceQuota owning the namespace.
+	Owner string `json:"owner"`
 }
 
 // ResourceUsage is aggregated usages of the resource.
@@ -47,17 +425,274 @@ type ResourceUsage struct {
 	Namespaces map[string]resource.Quantity `json:"namespaces,omitempty"`
 }
 
+// ScopedQuotaStatus is the observed state of a scoped quota.
+type ScopedQuotaStatus struct {
+	// Name is the name of the scoped quota.
+	Name string `json:"name"`
+
+	// Allocated is the current observed allocated resources to namespaces in the scope.
+	// +optional
+	Allocated map[corev1.ResourceName]ResourceUsage `json:"allocated,omitempty"`
+
+	// Used is the current observed usage of the resource in the scope.
+	// +optional
+	Used map[corev1.ResourceName]ResourceUsage `json:"used,omitempty"`
+}
+
+// AppliedQuotaLease is a namespace lease added to the managed resource quota of the namespace.
+type AppliedQuotaLease struct {
+	// Name is the name of the lease.
+	Name string `json:"name"`
+
+	// Namespace is the namespace whose managed resource quota is raised by the lease.
+	Namespace string `json:"namespace"`
+
+	// Hard is the set of hard limits added to the managed resource quota.
+	Hard corev1.ResourceList `json:"hard"`
+}
+
+// IdleAllocation is an allocation of a namespace unused beyond the headroom of the reclaim policy.
+type IdleAllocation struct {
+	// Namespace is the name of the namespace.
+	Namespace string `json:"namespace"`
+
+	// Resource is the name of the resource.
+	Resource corev1.ResourceName `json:"resource"`
+
+	// Since is the time when the allocation was first observed idle.
+	Since metav1.Time `json:"since"`
+}
+
+// ReclaimedAllocation is the last reclamation from a namespace.
+type ReclaimedAllocation struct {
+	// Namespace is the name of the namespace.
+	Namespace string `json:"namespace"`
+
+	// Resource is the name of the resource.
+	Resource corev1.ResourceName `json:"resource"`
+
+	// Quantity is the amount of the resource reclaimed from the namespace.
+	Quantity resource.Quantity `json:"quantity"`
+
+	// Hard is the hard limit of the namespace after the reclamation.
+	Hard resource.Quantity `json:"hard"`
+
+	// ReclaimedAt is the time of the reclamation.
+	ReclaimedAt metav1.Time `json:"reclaimedAt"`
+}
+
+// MissingResource is a resource of the hard limits absent in the resource quotas of some namespaces.
+// Namespaces that started lacking the resource at different times are listed in separate entries.
+type MissingResource struct {
+	// ResourceQuota is the name of the resource quota.
+	ResourceQuota string `json:"resourceQuota"`
+
+	// Resource is the name of the resource.
+	Resource corev1.ResourceName `json:"resource"`
+
+	// Namespaces is the list of namespaces whose resource quota lacks the resource.
+	Namespaces []string `json:"namespaces"`
+
+	// Since is the time when the resource was first observed missing in the namespaces.
+	Since metav1.Time `json:"since"`
+}
+
+// ReservationTTL is how long a reserved raise is counted until the controller observes it.
+const ReservationTTL = time.Minute
+
+// QuotaReservation is a raise of the hard limits of a resource quota admitted by the webhook
+// and not yet observed in the allocation of the tenant.
+type QuotaReservation struct {
+	// Namespace is the name of the namespace.
+	Namespace string `json:"namespace"`
+
+	// ResourceQuota is the name of the resource quota.
+	ResourceQuota string `json:"resourceQuota"`
+
+	// Hard is the set of hard limits reserved for the resource quota.
+	Hard corev1.ResourceList `json:"hard"`
+
+	// ExpiresAt is the time when the reservation is no longer counted.
+	ExpiresAt metav1.Time `json:"expiresAt"`
+}
+
+// IsActive returns true if the reservation is not expired at the time.
+func (r *QuotaReservation) IsActive(now time.Time) bool {
+	return now.Before(r.ExpiresAt.Time)
+}
+
+// SetReservation merges the reservation into the reservation of the same resource quota, or adds the reservation.
+// Expired reservations are removed.
+func (s *TenantResourceQuotaStatus) SetReservation(reservation QuotaReservation, now time.Time) {
+	var result []QuotaReservation
+	for _, r := range s.Reservations {
+		if !r.IsActive(now) {
+			continue
+		}
+		if r.Namespace == reservation.Namespace && r.ResourceQuota == reservation.ResourceQuota {
+			for resourceName, hard := range r.Hard {
+				if _, ok := reservation.Hard[resourceName]; !ok {
+					reservation.Hard[resourceName] = hard
+				}
+			}
+			continue
+		}
+		result = append(result, r)
+	}
+	s.Reservations = append(result, reservation)
+}
+
+// MissingSince returns the time when the resource was first observed missing in the resource quota of the namespace.
+// ok is false if the resource has not been observed missing.
+func (s *TenantResourceQuotaStatus) MissingSince(resourceQuota string, resourceName corev1.ResourceName, namespace string) (since metav1.Time, ok bool) {
+	for _, missing := range s.MissingResources {
+		if missing.ResourceQuota != resourceQuota || missing.Resource != resourceName {
+			continue
+		}
+		for _, ns := range missing.Namespaces {
+			if ns == namespace {
+				return missing.Since, true
+			}
+		}
+	}
+	return metav1.Time{}, false
+}
+
+// NamespaceFieldOwners is the field managers of the hard limits of the managed resource quota in a namespace.
+type NamespaceFieldOwners struct {
+	// Namespace is the name of the namespace.
+	Namespace string `json:"namespace"`
+
+	// Hard is the field managers owning the hard limit of each resource, separated by commas.
+	Hard map[corev1.ResourceName]string `json:"hard"`
+}
+
+// TenantLimitViolation is a change of a resource quota exceeding the hard limits of the tenant allowed by the DryRun enforcement mode.
+type TenantLimitViolation struct {
+	// Namespace is the name of the namespace.
+	Namespace string `json:"namespace"`
+
+	// ResourceQuota is the name of the resource quota.
+	ResourceQuota string `json:"resourceQuota"`
+
+	// Resource is the name of the resource.
+	Resource corev1.ResourceName `json:"resource"`
+
+	// Requested is the hard limit of the resource requested for the resource quota.
+	Requested resource.Quantity `json:"requested"`
+
+	// Total is the total allocation of the tenant with the change.
+	Total resource.Quantity `json:"total"`
+
+	// Hard is the hard limit of the tenant.
+	Hard resource.Quantity `json:"hard"`
+
+	// ObservedAt is the time when the change was admitted.
+	ObservedAt metav1.Time `json:"observedAt"`
+}
+
 // TenantResourceQuotaStatus defines the observed state of TenantResourceQuota
 type TenantResourceQuotaStatus struct {
 	// Allocated is the current observed allocated resources to namespaces in the tenant.
+	// It also includes namespaces of the child tenants.
 	// +optional
 	Allocated map[corev1.ResourceName]ResourceUsage `json:"allocated,omitempty"`
 
 	// Used is the current observed usage of the resource in the tenant.
+	// It also includes namespaces of the child tenants.
 	// +optional
 	Used map[corev1.ResourceName]ResourceUsage `json:"used,omitempty"`
+
+	// NamespaceLimitViolations is the list of namespaces whose allocation is out of NamespaceLimits.
+	// +optional
+	NamespaceLimitViolations []NamespaceLimitViolation `json:"namespaceLimitViolations,omitempty"`
+
+	// DryRunViolations is the list of the last change of each resource in each resource quota
+	// that would have been denied by the hard limits without the DryRun enforcement mode.
+	// It is cleared when the enforcement mode is changed.
+	// +optional
+	DryRunViolations []TenantLimitViolation `json:"dryRunViolations,omitempty"`
+
+	// MissingResources is the list of resources of the hard limits absent in the resource quotas of namespaces.
+	// The controller backfills them.
+	// +optional
+	MissingResources []MissingResource `json:"missingResources,omitempty"`
+
+	// Conflicts is the list of namespaces selected by this tenant and other tenants.
+	// +optional
+	Conflicts []NamespaceConflict `json:"conflicts,omitempty"`
+
+	// FieldOwners is the field managers of the hard limits of the managed resource quota in each namespace.
+	// +optional
+	FieldOwners []NamespaceFieldOwners `json:"fieldOwners,omitempty"`
+
+	// ScopedQuotas is the observed state of each scoped quota.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	ScopedQuotas []ScopedQuotaStatus `json:"scopedQuotas,omitempty"`
+
+	// EffectiveHard is the hard limits currently effective with the schedules and the leases.
+	// +optional
+	EffectiveHard corev1.ResourceList `json:"effectiveHard,omitempty"`
+
+	// Schedule is the name of the schedule currently effective.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Leases is the list of namespace leases added to the managed resource quotas.
+	// They are reverted when they expire or are removed from the spec.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Leases []AppliedQuotaLease `json:"leases,omitempty"`
+
+	// Idle is the list of allocations waiting for reclamation.
+	// +optional
+	Idle []IdleAllocation `json:"idle,omitempty"`
+
+	// Reclaimed is the list of the last reclamation of each resource in each namespace.
+	// +optional
+	Reclaimed []ReclaimedAllocation `json:"reclaimed,omitempty"`
+
+	// Reservations is the list of raises of resource quotas admitted by the webhook and not yet observed in the allocation.
+	// The webhook counts them in addition to the allocation so that concurrent raises do not exceed the hard limits.
+	// They are removed when the controller observes them or they expire.
+	// +optional
+	Reservations []QuotaReservation `json:"reservations,omitempty"`
+
+	// ObservedGeneration is the most recent generation reconciled by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the tenant.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// Condition types of TenantResourceQuota.
+const (
+	// ConditionReady is true when the latest spec has been reconciled successfully.
+	ConditionReady = "Ready"
+
+	// ConditionOverAllocated is true when the allocated resources exceed the hard limits.
+	ConditionOverAllocated = "OverAllocated"
+
+	// ConditionReconciling is true while the controller is still working toward the latest spec.
+	ConditionReconciling = "Reconciling"
+
+	// ConditionDegraded is true when the last reconciliation failed.
+	ConditionDegraded = "Degraded"
+
+	// ConditionUsageAboveThreshold is true when the usage of a resource is above the threshold of the usage guard.
+	ConditionUsageAboveThreshold = "UsageAboveThreshold"
+
+	// ConditionNamespaceConflict is true when a selected namespace is also selected by other tenants.
+	ConditionNamespaceConflict = "NamespaceConflict"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:resource:scope=Cluster
@@ -80,6 +715,220 @@ type TenantResourceQuotaList struct {
 	Items           []TenantResourceQuota `json:"items"`
 }
 
+// DefaultResourceQuotaName is the name of the managed resource quota if ResourceQuotaName is not set.
+const DefaultResourceQuotaName = "default"
+
+// GetResourceQuotaName returns the name of the resource quota managed in each namespace of the tenant.
+func (q *TenantResourceQuota) GetResourceQuotaName() string {
+	if q.Spec.ResourceQuotaName == "" {
+		return DefaultResourceQuotaName
+	}
+	return q.Spec.ResourceQuotaName
+}
+
+// AncestorResourceQuotaName returns the name of the resource quotas of the ancestor limiting the resource quotas of the name in the tenant.
+// The managed resource quotas of the tenant are limited as the managed resource quotas of the ancestor,
+// and the scoped quotas by the scoped quotas of the same name.
+func (q *TenantResourceQuota) AncestorResourceQuotaName(ancestor *TenantResourceQuota, name string) string {
+	if name == q.GetResourceQuotaName() {
+		return ancestor.GetResourceQuotaName()
+	}
+	return name
+}
+
+// IsDynamic returns true if the controller computes the allocation of each namespace.
+func (q *TenantResourceQuota) IsDynamic() bool {
+	return q.Spec.AllocationPolicy == AllocationDynamic
+}
+
+// IsApprovedFieldManager returns true if the field manager is allowed to change the hard limits of the managed resource quotas
+// under the Reject field ownership policy. The controller itself is approved by the callers.
+func (q *TenantResourceQuota) IsApprovedFieldManager(manager string) bool {
+	for _, approved := range q.Spec.ApprovedFieldManagers {
+		if approved == manager {
+			return true
+		}
+	}
+	return false
+}
+
+// NamespaceWeight returns the weight of the namespace under the Dynamic allocation policy.
+func (q *TenantResourceQuota) NamespaceWeight(namespace string) int64 {
+	if weight, ok := q.Spec.NamespaceWeights[namespace]; ok {
+		return int64(weight)
+	}
+	return 1
+}
+
+// ActiveSchedule returns the first schedule whose window is open at now, or nil if no window is open.
+// Schedules with invalid times are ignored.
+func (q *TenantResourceQuota) ActiveSchedule(now time.Time) *QuotaSchedule {
+	for i := range q.Spec.Schedules {
+		if open, _, err := q.Spec.Schedules[i].Window(now); err == nil && open {
+			return &q.Spec.Schedules[i]
+		}
+	}
+	return nil
+}
+
+// EffectiveHard returns the hard limits replaced by the schedule active at now and raised by the leases active at now.
+func (q *TenantResourceQuota) EffectiveHard(now time.Time) corev1.ResourceList {
+	effective := q.Spec.Hard.DeepCopy()
+	if schedule := q.ActiveSchedule(now); schedule != nil {
+		for resourceName, hard := range schedule.Hard {
+			if _, ok := effective[resourceName]; ok {
+				effective[resourceName] = hard.DeepCopy()
+			}
+		}
+	}
+	for _, lease := range q.Spec.Leases {
+		if !lease.IsActive(now) {
+			continue
+		}
+		for resourceName, quantity := range lease.Hard {
+			hard, ok := effective[resourceName]
+			if !ok {
+				continue
+			}
+			hard.Add(quantity)
+			effective[resourceName] = hard
+		}
+	}
+	return effective
+}
+
+// NextHardChange returns the earliest time after now when a lease expires or a schedule window opens or closes.
+// It returns false if the effective hard limits never change.
+func (q *TenantResourceQuota) NextHardChange(now time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	update := func(t time.Time) {
+		if !found || t.Before(next) {
+			next = t
+			found = true
+		}
+	}
+	for _, lease := range q.Spec.Leases {
+		if lease.IsActive(now) {
+			update(lease.ExpiresAt.Time)
+		}
+	}
+	for i := range q.Spec.Schedules {
+		if _, t, err := q.Spec.Schedules[i].Window(now); err == nil && !t.IsZero() {
+			update(t)
+		}
+	}
+	return next, found
+}
+
+// NextReclaim returns the earliest time when an idle allocation in the status becomes reclaimable.
+// It returns false if reclamation is disabled or no allocation is idle.
+func (q *TenantResourceQuota) NextReclaim() (time.Time, bool) {
+	if q.Spec.Reclaim == nil || len(q.Status.Idle) == 0 {
+		return time.Time{}, false
+	}
+	var next time.Time
+	for i, idle := range q.Status.Idle {
+		t := idle.Since.Add(q.Spec.Reclaim.IdlePeriod.Duration)
+		if i == 0 || t.Before(next) {
+			next = t
+		}
+	}
+	return next, true
+}
+
+// AllocatableHard returns the effective hard limits at now multiplied by the overcommit of each resource.
+func (q *TenantResourceQuota) AllocatableHard(now time.Time) corev1.ResourceList {
+	effective := q.EffectiveHard(now)
+	allocatable := make(corev1.ResourceList, len(effective))
+	for resourceName, hard := range effective {
+		percent, ok := q.Spec.Overcommit[resourceName]
+		if !ok {
+			allocatable[resourceName] = hard.DeepCopy()
+			continue
+		}
+		allocatable[resourceName] = percentOf(hard, percent)
+	}
+	return allocatable
+}
+
+// UsageThreshold returns the effective hard limits at now multiplied by the threshold of the usage guard.
+// It returns nil if the usage guard is not configured.
+func (q *TenantResourceQuota) UsageThreshold(now time.Time) corev1.ResourceList {
+	if q.Spec.UsageGuard == nil {
+		return nil
+	}
+	effective := q.EffectiveHard(now)
+	threshold := make(corev1.ResourceList, len(effective))
+	for resourceName, hard := range effective {
+		threshold[resourceName] = percentOf(hard, q.Spec.UsageGuard.ThresholdPercent)
+	}
+	return threshold
+}
+
+// Limit returns the hard limits and the allocation of the tenant for the resource quota of the name at now.
+// The managed resource quota is limited by the allocatable hard limits and the hard patterns
+// and the others by the scoped quota of the same name.
+// The allocation includes the active reservations of the resource quotas of the name.
+func (q *TenantResourceQuota) Limit(name string, now time.Time) (corev1.ResourceList, map[corev1.ResourceName]ResourceUsage, bool) {
+	if name == q.GetResourceQuotaName() {
+		hard := q.AllocatableHard(now)
+		for pattern, quantity := range q.Spec.HardPatterns {
+			hard[pattern] = quantity
+		}
+		return hard, withReservations(q.Status.Allocated, q.Status.Reservations, name, now), true
+	}
+
+	for _, scopedQuota := range q.Spec.ScopedQuotas {
+		if scopedQuota.Name != name {
+			continue
+		}
+		for _, status := range q.Status.ScopedQuotas {
+			if status.Name == name {
+				return scopedQuota.Hard, withReservations(status.Allocated, q.Status.Reservations, name, now), true
+			}
+		}
+		return scopedQuota.Hard, withReservations(nil, q.Status.Reservations, name, now), true
+	}
+	return nil, nil, false
+}
+
+// withReservations returns a copy of the allocation where the reserved hard limits of the resource quotas of the name
+// replace the allocated ones if they are larger.
+func withReservations(allocated map[corev1.ResourceName]ResourceUsage, reservations []QuotaReservation, name string, now time.Time) map[corev1.ResourceName]ResourceUsage {
+	result := make(map[corev1.ResourceName]ResourceUsage, len(allocated))
+	for resourceName, usage := range allocated {
+		result[resourceName] = *usage.DeepCopy()
+	}
+	for _, reservation := range reservations {
+		if reservation.ResourceQuota != name || !reservation.IsActive(now) {
+			continue
+		}
+		for resourceName, reserved := range reservation.Hard {
+			usage := result[resourceName]
+			if usage.Namespaces == nil {
+				usage.Namespaces = make(map[string]resource.Quantity)
+			}
+			current := usage.Namespaces[reservation.Namespace]
+			if reserved.Cmp(current) <= 0 {
+				continue
+			}
+			usage.Total.Add(reserved)
+			usage.Total.Sub(current)
+			usage.Namespaces[reservation.Namespace] = reserved.DeepCopy()
+			result[resourceName] = usage
+		}
+	}
+	return result
+}
+
+func percentOf(quantity resource.Quantity, percent int32) resource.Quantity {
+	q := quantity.DeepCopy()
+	dec := q.AsDec()
+	dec.Mul(dec, inf.NewDec(int64(percent), 2))
+	return *resource.NewDecimalQuantity(*dec, quantity.Format)
+}
+
 func init() {
 	SchemeBuilder.Register(&TenantResourceQuota{}, &TenantResourceQuotaList{})
 }
@@ -20,6 +20,11 @@ var options struct {
 	leaderElectionID string
 	webhookAddr      string
 	certDir          string
+	deleterGroups    []string
+	bypassUsers      []string
+	bypassGroups     []string
+	bypassSAs        []string
+	liveAllocation   bool
 	zapOpts          zap.Options
 }
 
@@ -67,6 +72,11 @@ func init() {
 	fs.StringVar(&options.leaderElectionID, "leader-election-id", "necotiator", "ID for leader election by controller-runtime")
 	fs.StringVar(&options.webhookAddr, "webhook-addr", ":9443", "Listen address for the webhook endpoint")
 	fs.StringVar(&options.certDir, "cert-dir", "", "webhook certificate directory")
+	fs.StringSliceVar(&options.deleterGroups, "quota-deleter-groups", nil, "Groups allowed to delete resource quotas managed by tenants")
+	fs.StringSliceVar(&options.bypassUsers, "bypass-users", nil, "Users exempted from the label immutability and the tenant limits of resource quotas")
+	fs.StringSliceVar(&options.bypassGroups, "bypass-groups", nil, "Groups exempted from the label immutability and the tenant limits of resource quotas")
+	fs.StringSliceVar(&options.bypassSAs, "bypass-service-accounts", nil, "Service accounts in the form of namespace:name exempted from the label immutability and the tenant limits of resource quotas")
+	fs.BoolVar(&options.liveAllocation, "webhook-live-allocation", false, "Compute the allocation of tenants from the cached resource quotas instead of the status in the webhook")
 
 	goflags := flag.NewFlagSet("klog", flag.ExitOnError)
 	klog.InitFlags(goflags)
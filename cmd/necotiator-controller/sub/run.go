@@ -54,16 +54,37 @@ func subMain(ns, sa, addr string, port int) error {
 	}).SetupWithManager(ctx, mgr); err != nil {
 		return fmt.Errorf("unable to create Tenant Resource Quota controller: %w", err)
 	}
+	if err := (&controllers.QuotaTransferReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor(constants.EventRecorderName),
+	}).SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create Quota Transfer controller: %w", err)
+	}
+	if err := (&controllers.QuotaRequestReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor(constants.EventRecorderName),
+	}).SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create Quota Request controller: %w", err)
+	}
 
 	if err = controllers.SetupMetrics(ctx, mgr.GetClient()); err != nil {
 		return fmt.Errorf("unable to setup metrics %w", err)
 	}
-	if err = hooks.SetupResourceQuotaWebhookWithManager(mgr, ns, sa); err != nil {
+	if err = hooks.SetupResourceQuotaWebhookWithManager(mgr, ns, sa, options.deleterGroups, hooks.BypassIdentities{
+		Users:           options.bypassUsers,
+		Groups:          options.bypassGroups,
+		ServiceAccounts: options.bypassSAs,
+	}, options.liveAllocation); err != nil {
 		return fmt.Errorf("unable to create ResourceQuota Webhook %w", err)
 	}
 	if err = hooks.SetupTenantResourceQuotaWebhookWithManager(mgr); err != nil {
 		return fmt.Errorf("unable to create TenantResourceQuota webhook %w", err)
 	}
+	if err = hooks.SetupUsageWebhookWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create usage webhook %w", err)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
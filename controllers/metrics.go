@@ -15,6 +15,10 @@ var (
 		"necotiator_tenantresourcequota",
 		"Information about tenant resource quota",
 		[]string{"tenantresourcequota", "resource", "type"}, nil)
+	conflictingNamespacesDesc = prometheus.NewDesc(
+		"necotiator_tenantresourcequota_conflicting_namespaces",
+		"Number of namespaces selected by the tenant resource quota and other tenants",
+		[]string{"tenantresourcequota"}, nil)
 )
 
 type tenantResourceQuotaCollector struct {
@@ -24,6 +28,7 @@ type tenantResourceQuotaCollector struct {
 
 func (c *tenantResourceQuotaCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- tenantResourceQuotaDesc
+	ch <- conflictingNamespacesDesc
 }
 
 func (c *tenantResourceQuotaCollector) Collect(ch chan<- prometheus.Metric) {
@@ -57,6 +62,17 @@ func (c *tenantResourceQuotaCollector) Collect(ch chan<- prometheus.Metric) {
 				quota.Name, string(resourceName), "used",
 			)
 		}
+
+		namespaces := make(map[string]struct{})
+		for _, conflict := range quota.Status.Conflicts {
+			namespaces[conflict.Namespace] = struct{}{}
+		}
+		ch <- prometheus.MustNewConstMetric(
+			conflictingNamespacesDesc,
+			prometheus.GaugeValue,
+			float64(len(namespaces)),
+			quota.Name,
+		)
 	}
 }
 
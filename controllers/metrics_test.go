@@ -129,6 +129,37 @@ var _ = Describe("Test tenantResourceQuotaCollector", func() {
 		}))
 	})
 
+	It("should export necotiator_tenantresourcequota_conflicting_namespaces", func() {
+		name := newTestObjectName()
+		quota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: v1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		quota.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
+			Conflicts: []necotiatorv1beta1.NamespaceConflict{
+				{Namespace: "ns-a", Tenant: "tenant-x", Owner: name},
+				{Namespace: "ns-a", Tenant: "tenant-y", Owner: name},
+				{Namespace: "ns-b", Tenant: "tenant-x", Owner: "tenant-x"},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		metrics := getMetrics()
+		Expect(metrics).Should(MatchKeys(IgnoreExtras, Keys{
+			fmt.Sprintf("necotiator_tenantresourcequota_conflicting_namespaces{tenantresourcequota=%s}", name): BeNumerically("==", 2),
+		}))
+	})
+
 	It("should not export necotiator_tenantresourcequota after deletion", func() {
 		name := newTestObjectName()
 		quota := &necotiatorv1beta1.TenantResourceQuota{
@@ -0,0 +1,253 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
+)
+
+// QuotaRequestReconciler reconciles a QuotaRequest object
+type QuotaRequestReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	apiReader client.Reader
+}
+
+//+kubebuilder:rbac:groups=necotiator.cybozu.io,resources=quotarequests,verbs=get;list;watch
+//+kubebuilder:rbac:groups=necotiator.cybozu.io,resources=quotarequests/status,verbs=get;update;patch
+
+// Reconcile applies a QuotaRequest to the managed resource quota of its namespace once it is approved.
+// Requests within the auto approval of the tenant are approved by the controller,
+// and the others wait for an administrator of the tenant to set the Approved condition.
+func (r *QuotaRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var request necotiatorv1beta1.QuotaRequest
+	err := r.Get(ctx, req.NamespacedName, &request)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if request.Status.Phase == necotiatorv1beta1.QuotaRequestApplied || request.Status.Phase == necotiatorv1beta1.QuotaRequestDenied {
+		return ctrl.Result{}, nil
+	}
+
+	tenantQuota, rq, err := managedResourceQuota(ctx, r.Client, request.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if tenantQuota == nil {
+		return ctrl.Result{}, r.updatePhase(ctx, &request, nil, necotiatorv1beta1.QuotaRequestDenied,
+			fmt.Sprintf("namespace %s does not belong to any tenant", request.Namespace))
+	}
+
+	if tenantQuota.IsDynamic() {
+		return ctrl.Result{}, r.updatePhase(ctx, &request, tenantQuota, necotiatorv1beta1.QuotaRequestDenied,
+			fmt.Sprintf("tenant quota %s allocates resources dynamically", tenantQuota.Name))
+	}
+
+	if err := r.validateHeadroom(ctx, &request, tenantQuota, rq.Name); err != nil {
+		return ctrl.Result{}, r.updatePhase(ctx, &request, tenantQuota, necotiatorv1beta1.QuotaRequestDenied, err.Error())
+	}
+
+	// An approval or a rejection of an older spec does not apply to the current one.
+	approved := meta.FindStatusCondition(request.Status.Conditions, necotiatorv1beta1.ConditionApproved)
+	if approved != nil && approved.ObservedGeneration != request.Generation {
+		approved = nil
+	}
+	switch {
+	case approved != nil && approved.Status == metav1.ConditionFalse:
+		return ctrl.Result{}, r.updatePhase(ctx, &request, tenantQuota, necotiatorv1beta1.QuotaRequestDenied,
+			fmt.Sprintf("rejected: %s", approved.Message))
+	case approved != nil && approved.Status == metav1.ConditionTrue:
+	case autoApprovable(&request, tenantQuota, rq):
+		meta.SetStatusCondition(&request.Status.Conditions, metav1.Condition{
+			Type:               necotiatorv1beta1.ConditionApproved,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: request.Generation,
+			Reason:             "AutoApproved",
+			Message:            fmt.Sprintf("the increase is within the auto approval of tenant quota: %s", tenantQuota.Name),
+		})
+	default:
+		return ctrl.Result{}, r.updatePhase(ctx, &request, tenantQuota, necotiatorv1beta1.QuotaRequestPending,
+			fmt.Sprintf("waiting for approval by an administrator of tenant quota: %s", tenantQuota.Name))
+	}
+
+	logger.Info("Applying quota request", "namespace", request.Namespace, "hard", request.Spec.Hard)
+	err = r.applyHard(ctx, client.ObjectKeyFromObject(rq), request.Spec.Hard)
+	if apierrors.IsInvalid(err) || apierrors.IsForbidden(err) {
+		return ctrl.Result{}, r.updatePhase(ctx, &request, tenantQuota, necotiatorv1beta1.QuotaRequestDenied, err.Error())
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, r.updatePhase(ctx, &request, tenantQuota, necotiatorv1beta1.QuotaRequestApplied,
+		fmt.Sprintf("Applied %s to namespace %s", formatResources(request.Spec.Hard), request.Namespace))
+}
+
+// validateHeadroom checks that the requested hard limits fit in the remaining resources of the tenant and its ancestors.
+// The tenants are read bypassing the cache and the active reservations are counted, so that the request is denied
+// with the messages of all resources before the resource quota webhook denies the first one.
+func (r *QuotaRequestReconciler) validateHeadroom(ctx context.Context, request *necotiatorv1beta1.QuotaRequest, tenantQuota *necotiatorv1beta1.TenantResourceQuota, name string) error {
+	var messages []string
+	for _, resourceName := range sortedResourceNames(request.Spec.Hard) {
+		if _, ok := tenantQuota.Spec.Hard[resourceName]; !ok {
+			messages = append(messages, fmt.Sprintf("%s is not limited by tenant quota: %s", resourceName, tenantQuota.Name))
+		}
+	}
+
+	visited := map[string]bool{}
+	for quotaName := tenantQuota.Name; quotaName != ""; {
+		if visited[quotaName] {
+			return fmt.Errorf("circular parent reference of tenant resource quota: %s", quotaName)
+		}
+		visited[quotaName] = true
+
+		var quota necotiatorv1beta1.TenantResourceQuota
+		err := r.apiReader.Get(ctx, client.ObjectKey{Name: quotaName}, &quota)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, headroomViolations(request, &quota, tenantQuota.AncestorResourceQuotaName(&quota, name))...)
+		quotaName = quota.Spec.Parent
+	}
+
+	if len(messages) > 0 {
+		return fmt.Errorf("invalid request: %s", strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// headroomViolations returns the messages for the requested hard limits making the allocation of the tenant
+// for the resource quotas of the name exceed its hard limits.
+func headroomViolations(request *necotiatorv1beta1.QuotaRequest, quota *necotiatorv1beta1.TenantResourceQuota, name string) []string {
+	hard, allocation, ok := quota.Limit(name, time.Now())
+	if !ok {
+		return nil
+	}
+
+	var messages []string
+	for _, resourceName := range sortedResourceNames(request.Spec.Hard) {
+		limit, ok := hard[resourceName]
+		if !ok {
+			continue
+		}
+		requested := request.Spec.Hard[resourceName]
+		allocated := allocation[resourceName]
+
+		newTotal := allocated.Total.DeepCopy()
+		if current, ok := allocated.Namespaces[request.Namespace]; ok {
+			if requested.Cmp(current) <= 0 {
+				continue
+			}
+			newTotal.Sub(current)
+		}
+		newTotal.Add(requested)
+
+		if newTotal.Cmp(limit) > 0 {
+			messages = append(messages, fmt.Sprintf(
+				"exceeded tenant quota: %s, requested: %s=%s, total: %s=%s, limited: %s=%s",
+				quota.Name,
+				resourceName, requested.String(),
+				resourceName, newTotal.String(),
+				resourceName, limit.String(),
+			))
+		}
+	}
+	return messages
+}
+
+// autoApprovable returns true if no resource is raised by more than the auto approval of the tenant.
+func autoApprovable(request *necotiatorv1beta1.QuotaRequest, tenantQuota *necotiatorv1beta1.TenantResourceQuota, rq *corev1.ResourceQuota) bool {
+	for resourceName, requested := range request.Spec.Hard {
+		increase := requested.DeepCopy()
+		increase.Sub(rq.Spec.Hard[resourceName])
+		if increase.Sign() <= 0 {
+			continue
+		}
+		limit, ok := tenantQuota.Spec.AutoApprove[resourceName]
+		if !ok || increase.Cmp(limit) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// applyHard sets the hard limits of the resource quota.
+func (r *QuotaRequestReconciler) applyHard(ctx context.Context, key client.ObjectKey, hard corev1.ResourceList) error {
+	return updateResourceQuota(ctx, r.Client, key, func(rq *corev1.ResourceQuota) error {
+		for resourceName, quantity := range hard {
+			rq.Spec.Hard[resourceName] = quantity
+		}
+		return nil
+	})
+}
+
+// updatePhase records the phase in the status and an event on the tenant resource quota when the phase changes.
+// tenantQuota is nil if the tenant is unknown.
+func (r *QuotaRequestReconciler) updatePhase(ctx context.Context, request *necotiatorv1beta1.QuotaRequest, tenantQuota *necotiatorv1beta1.TenantResourceQuota, phase necotiatorv1beta1.QuotaRequestPhase, message string) error {
+	logger := log.FromContext(ctx)
+
+	old := request.Status.DeepCopy()
+	if tenantQuota != nil {
+		request.Status.Tenant = tenantQuota.Name
+	}
+	request.Status.Phase = phase
+	request.Status.Message = message
+	if equality.Semantic.DeepEqual(old, &request.Status) {
+		return nil
+	}
+
+	logger.Info("Quota request", "phase", phase, "message", message)
+	if tenantQuota != nil && old.Phase != phase {
+		eventType := corev1.EventTypeNormal
+		if phase == necotiatorv1beta1.QuotaRequestDenied {
+			eventType = corev1.EventTypeWarning
+		}
+		r.Recorder.Event(tenantQuota, eventType, "QuotaRequest"+string(phase), fmt.Sprintf(
+			"QuotaRequest %s/%s: %s", request.Namespace, request.Name, message,
+		))
+	}
+
+	return r.Status().Update(ctx, request)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *QuotaRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.apiReader = mgr.GetAPIReader()
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&necotiatorv1beta1.QuotaRequest{}).
+		Complete(r)
+}
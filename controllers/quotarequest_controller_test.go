@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
+	"github.com/cybozu-go/necotiator/pkg/constants"
+)
+
+var _ = Describe("Test QuotaRequestController", func() {
+	ctx := context.Background()
+	var stopFunc func()
+	var tenantResourceQuotaName string
+	var namespaceName string
+
+	BeforeEach(func() {
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = (&TenantResourceQuotaReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   scheme,
+			Recorder: mgr.GetEventRecorderFor(constants.EventRecorderName),
+		}).SetupWithManager(ctx, mgr)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = (&QuotaRequestReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   scheme,
+			Recorder: mgr.GetEventRecorderFor(constants.EventRecorderName),
+		}).SetupWithManager(mgr)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(ctx)
+		stopFunc = cancel
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		tenantResourceQuotaName = newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.NamespaceDefaults = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("20m"),
+		}
+		tenantResourceQuota.Spec.AutoApprove = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("30m"),
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		namespaceName = newTestObjectName()
+		err = k8sClient.Create(ctx, newNamespace(namespaceName, teamName))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: namespaceName, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("20m")),
+			}))
+		}).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		stopFunc()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	newQuotaRequest := func(cpu string) *necotiatorv1beta1.QuotaRequest {
+		return &necotiatorv1beta1.QuotaRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      newTestObjectName(),
+				Namespace: namespaceName,
+			},
+			Spec: necotiatorv1beta1.QuotaRequestSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse(cpu),
+				},
+			},
+		}
+	}
+
+	expectHard := func(cpu string) {
+		var quota corev1.ResourceQuota
+		err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespaceName, Name: constants.ResourceQuotaNameDefault}, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+			corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse(cpu)),
+		}))
+	}
+
+	It("should apply request within auto approval", func() {
+		request := newQuotaRequest("40m")
+		err := k8sClient.Create(ctx, request)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(request), request)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(request.Status.Phase).Should(Equal(necotiatorv1beta1.QuotaRequestApplied))
+			g.Expect(request.Status.Tenant).Should(Equal(tenantResourceQuotaName))
+
+			condition := meta.FindStatusCondition(request.Status.Conditions, necotiatorv1beta1.ConditionApproved)
+			g.Expect(condition).ShouldNot(BeNil())
+			g.Expect(condition.Status).Should(Equal(metav1.ConditionTrue))
+			g.Expect(condition.Reason).Should(Equal("AutoApproved"))
+		}).Should(Succeed())
+
+		expectHard("40m")
+	})
+
+	It("should wait for approval of request beyond auto approval", func() {
+		request := newQuotaRequest("80m")
+		err := k8sClient.Create(ctx, request)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(request), request)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(request.Status.Phase).Should(Equal(necotiatorv1beta1.QuotaRequestPending))
+		}).Should(Succeed())
+		expectHard("20m")
+
+		meta.SetStatusCondition(&request.Status.Conditions, metav1.Condition{
+			Type:               necotiatorv1beta1.ConditionApproved,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: request.Generation,
+			Reason:             "Approved",
+			Message:            "approved by admin",
+		})
+		err = k8sClient.Status().Update(ctx, request)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(request), request)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(request.Status.Phase).Should(Equal(necotiatorv1beta1.QuotaRequestApplied))
+		}).Should(Succeed())
+
+		expectHard("80m")
+	})
+
+	It("should not apply request changed after approval", func() {
+		request := newQuotaRequest("80m")
+		err := k8sClient.Create(ctx, request)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(request), request)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(request.Status.Phase).Should(Equal(necotiatorv1beta1.QuotaRequestPending))
+		}).Should(Succeed())
+
+		approvedGeneration := request.Generation
+		request.Spec.Hard["limits.cpu"] = resource.MustParse("90m")
+		err = k8sClient.Update(ctx, request)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		By("approving the request with the generation before the change")
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(request), request)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			meta.SetStatusCondition(&request.Status.Conditions, metav1.Condition{
+				Type:               necotiatorv1beta1.ConditionApproved,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: approvedGeneration,
+				Reason:             "Approved",
+				Message:            "approved by admin",
+			})
+			err = k8sClient.Status().Update(ctx, request)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+
+		Consistently(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(request), request)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(request.Status.Phase).Should(Equal(necotiatorv1beta1.QuotaRequestPending))
+		}, 2*time.Second).Should(Succeed())
+		expectHard("20m")
+	})
+
+	It("should deny request exceeding tenant hard limits", func() {
+		request := newQuotaRequest("200m")
+		err := k8sClient.Create(ctx, request)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(request), request)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(request.Status.Phase).Should(Equal(necotiatorv1beta1.QuotaRequestDenied))
+			g.Expect(request.Status.Message).Should(ContainSubstring("exceeded tenant quota: %s, requested: limits.cpu=200m", tenantResourceQuotaName))
+		}).Should(Succeed())
+
+		expectHard("20m")
+
+		Eventually(func(g Gomega) {
+			var events corev1.EventList
+			err = k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(events.Items).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+					"Name": Equal(tenantResourceQuotaName),
+				}),
+				"Reason": Equal("QuotaRequestDenied"),
+			})))
+		}).Should(Succeed())
+	})
+})
@@ -0,0 +1,440 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
+	"github.com/cybozu-go/necotiator/pkg/constants"
+	"github.com/cybozu-go/necotiator/pkg/resourcename"
+)
+
+// QuotaTransferReconciler reconciles a QuotaTransfer object
+type QuotaTransferReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	apiReader client.Reader
+}
+
+//+kubebuilder:rbac:groups=necotiator.cybozu.io,resources=quotatransfers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=necotiator.cybozu.io,resources=quotatransfers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=necotiator.cybozu.io,resources=tenantresourcequotas/status,verbs=get;update;patch
+
+// Reconcile executes a QuotaTransfer once and records the result in its status.
+// Errors before the resource quotas are changed are retried, and the others make the transfer fail.
+func (r *QuotaTransferReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var transfer necotiatorv1beta1.QuotaTransfer
+	err := r.Get(ctx, req.NamespacedName, &transfer)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if transfer.Status.Phase != "" {
+		return ctrl.Result{}, nil
+	}
+
+	if transfer.Namespace == transfer.Spec.To {
+		return ctrl.Result{}, r.finish(ctx, &transfer, nil, fmt.Errorf("source and destination namespaces are the same: %s", transfer.Namespace))
+	}
+
+	tenantQuota, from, err := managedResourceQuota(ctx, r.Client, transfer.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if tenantQuota == nil {
+		return ctrl.Result{}, r.finish(ctx, &transfer, nil, fmt.Errorf("namespace %s does not belong to any tenant", transfer.Namespace))
+	}
+
+	toTenantQuota, to, err := managedResourceQuota(ctx, r.Client, transfer.Spec.To)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if toTenantQuota == nil || toTenantQuota.Name != tenantQuota.Name {
+		return ctrl.Result{}, r.finish(ctx, &transfer, tenantQuota, fmt.Errorf("namespace %s does not belong to tenant %s", transfer.Spec.To, tenantQuota.Name))
+	}
+	if tenantQuota.IsDynamic() {
+		return ctrl.Result{}, r.finish(ctx, &transfer, tenantQuota, fmt.Errorf("tenant %s allocates resources dynamically", tenantQuota.Name))
+	}
+
+	if err := validateTransfer(&transfer, tenantQuota, from, to); err != nil {
+		return ctrl.Result{}, r.finish(ctx, &transfer, tenantQuota, err)
+	}
+
+	logger.Info("Transferring resources", "from", transfer.Namespace, "to", transfer.Spec.To, "resources", transfer.Spec.Resources)
+	err = r.transfer(ctx, &transfer, tenantQuota, from, to)
+	return ctrl.Result{}, r.finish(ctx, &transfer, tenantQuota, err)
+}
+
+// managedResourceQuota returns the tenant resource quota of the namespace and the resource quota managed by it.
+// It returns nil if the namespace does not belong to any tenant.
+func managedResourceQuota(ctx context.Context, c client.Reader, namespace string) (*necotiatorv1beta1.TenantResourceQuota, *corev1.ResourceQuota, error) {
+	var quotas corev1.ResourceQuotaList
+	err := c.List(ctx, &quotas, client.InNamespace(namespace), client.HasLabels{constants.LabelTenant})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list resource quotas in namespace %s: %w", namespace, err)
+	}
+
+	for i := range quotas.Items {
+		rq := &quotas.Items[i]
+		var tenantQuota necotiatorv1beta1.TenantResourceQuota
+		err := c.Get(ctx, client.ObjectKey{Name: rq.Labels[constants.LabelTenant]}, &tenantQuota)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, nil, err
+		}
+		if err != nil {
+			continue
+		}
+		if rq.Name == tenantQuota.GetResourceQuotaName() {
+			return &tenantQuota, rq, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// validateTransfer checks that the source namespace has enough resources and both namespaces stay within the hard limits
+// and the namespace limits of the tenant. The total allocation of the tenant is not changed by the transfer.
+// The hard limits of the ancestors and the latest allocation are checked by reserveTransfer.
+func validateTransfer(transfer *necotiatorv1beta1.QuotaTransfer, tenantQuota *necotiatorv1beta1.TenantResourceQuota, from, to *corev1.ResourceQuota) error {
+	hard := tenantQuota.AllocatableHard(time.Now())
+
+	var messages []string
+	for _, resourceName := range sortedResourceNames(transfer.Spec.Resources) {
+		requested := transfer.Spec.Resources[resourceName]
+		limit, ok := hard[resourceName]
+		if !ok {
+			messages = append(messages, fmt.Sprintf("%s is not limited by tenant quota: %s", resourceName, tenantQuota.Name))
+			continue
+		}
+		if requested.Sign() <= 0 {
+			messages = append(messages, fmt.Sprintf("amount must be positive: %s=%s", resourceName, requested.String()))
+			continue
+		}
+
+		allocated := from.Spec.Hard[resourceName]
+		if allocated.Cmp(requested) < 0 {
+			messages = append(messages, fmt.Sprintf(
+				"insufficient resource in namespace %s, requested: %s=%s, allocated: %s=%s",
+				from.Namespace,
+				resourceName, requested.String(),
+				resourceName, allocated.String(),
+			))
+		}
+
+		newHard := to.Spec.Hard[resourceName].DeepCopy()
+		newHard.Add(requested)
+		if newHard.Cmp(limit) > 0 {
+			messages = append(messages, fmt.Sprintf(
+				"exceeded tenant quota: %s, requested: %s=%s, namespace %s: %s=%s, limited: %s=%s",
+				tenantQuota.Name,
+				resourceName, requested.String(),
+				to.Namespace, resourceName, newHard.String(),
+				resourceName, limit.String(),
+			))
+		}
+
+		if limits := tenantQuota.Spec.NamespaceLimits; limits != nil {
+			if maxHard, ok := limits.Max[resourceName]; ok && newHard.Cmp(maxHard) > 0 {
+				messages = append(messages, fmt.Sprintf(
+					"exceeded namespace maximum of tenant quota: %s, namespace %s: %s=%s, max: %s=%s",
+					tenantQuota.Name,
+					to.Namespace, resourceName, newHard.String(),
+					resourceName, maxHard.String(),
+				))
+			}
+			remaining := allocated.DeepCopy()
+			remaining.Sub(requested)
+			if minHard, ok := limits.Min[resourceName]; ok && !remaining.IsZero() && remaining.Cmp(minHard) < 0 {
+				messages = append(messages, fmt.Sprintf(
+					"below namespace minimum of tenant quota: %s, namespace %s: %s=%s, min: %s=%s",
+					tenantQuota.Name,
+					from.Namespace, resourceName, remaining.String(),
+					resourceName, minHard.String(),
+				))
+			}
+		}
+	}
+
+	if len(messages) > 0 {
+		return fmt.Errorf("invalid transfer: %s", strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// transfer moves the resources between the managed resource quotas.
+// The destination is reserved in the tenant and its ancestors before the source is decreased,
+// so that concurrent raises in other namespaces never take the resources freed by the source.
+// The source is decreased before the destination so that the allocation of the tenant never exceeds the hard limits.
+// The source is restored if the destination cannot be increased, which is still covered by the reservation of the destination.
+func (r *QuotaTransferReconciler) transfer(ctx context.Context, transfer *necotiatorv1beta1.QuotaTransfer, tenantQuota *necotiatorv1beta1.TenantResourceQuota, fromRQ, toRQ *corev1.ResourceQuota) error {
+	logger := log.FromContext(ctx)
+
+	from := client.ObjectKeyFromObject(fromRQ)
+	to := client.ObjectKeyFromObject(toRQ)
+
+	err := r.reserveTransfer(ctx, tenantQuota, transfer.Spec.Resources, fromRQ, toRQ)
+	if err != nil {
+		return err
+	}
+
+	err = r.updateHard(ctx, from, transfer.Spec.Resources, false)
+	if err != nil {
+		return fmt.Errorf("failed to decrease resource quota in namespace %s: %w", from.Namespace, err)
+	}
+
+	// The webhook may compute the allocation from a cache not yet observing the decrease of the source.
+	err = retry.OnError(retry.DefaultBackoff, apierrors.IsInvalid, func() error {
+		return r.updateHard(ctx, to, transfer.Spec.Resources, true)
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to increase resource quota in namespace %s: %w", to.Namespace, err)
+		if rollbackErr := r.updateHard(ctx, from, transfer.Spec.Resources, true); rollbackErr != nil {
+			logger.Error(rollbackErr, "Failed to restore resource quota", "namespace", from.Namespace)
+			return fmt.Errorf("%w, and failed to restore resource quota in namespace %s: %v", err, from.Namespace, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// reserveTransfer checks the transfer against the latest allocation of the tenant and its ancestors, and records it in their status.
+// The decreased source is recorded in the allocation and the increased destination in the reservations,
+// so the total allocation admitted by the webhook does not change until the destination is increased.
+func (r *QuotaTransferReconciler) reserveTransfer(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, resources corev1.ResourceList, from, to *corev1.ResourceQuota) error {
+	fromHard := from.Spec.Hard.DeepCopy()
+	toHard := to.Spec.Hard.DeepCopy()
+	for resourceName, quantity := range resources {
+		fromQuantity := fromHard[resourceName]
+		fromQuantity.Sub(quantity)
+		fromHard[resourceName] = fromQuantity
+		toQuantity := toHard[resourceName]
+		toQuantity.Add(quantity)
+		toHard[resourceName] = toQuantity
+	}
+
+	visited := make(map[string]bool)
+	for name := tenantQuota.Name; name != ""; {
+		if visited[name] {
+			return fmt.Errorf("circular parent reference of tenant resource quota: %s", name)
+		}
+		visited[name] = true
+
+		var parent string
+		err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+			var quota necotiatorv1beta1.TenantResourceQuota
+			err := r.apiReader.Get(ctx, client.ObjectKey{Name: name}, &quota)
+			if err != nil {
+				return err
+			}
+			parent = quota.Spec.Parent
+			if mode := quota.Spec.EnforcementMode; mode == necotiatorv1beta1.EnforcementWarn || mode == necotiatorv1beta1.EnforcementDryRun {
+				return nil
+			}
+
+			now := time.Now()
+			rqName := tenantQuota.AncestorResourceQuotaName(&quota, to.Name)
+			hard, allocated, ok := quota.Limit(rqName, now)
+			if !ok {
+				return nil
+			}
+			newFrom := resourcename.WithTotals(resourcename.Translate(fromHard, hard), hard)
+			newTo := resourcename.WithTotals(resourcename.Translate(toHard, hard), hard)
+
+			var messages []string
+			raised := make(corev1.ResourceList)
+			for _, resourceName := range sortedResourceNames(hard) {
+				requested := newTo[resourceName]
+				current := allocated[resourceName].Namespaces[to.Namespace]
+				if requested.Cmp(current) <= 0 {
+					continue
+				}
+				raised[resourceName] = requested
+
+				total := allocated[resourceName].Total.DeepCopy()
+				total.Sub(current)
+				total.Add(requested)
+				if currentFrom, ok := allocated[resourceName].Namespaces[from.Namespace]; ok {
+					if lowered := newFrom[resourceName]; lowered.Cmp(currentFrom) < 0 {
+						total.Sub(currentFrom)
+						total.Add(lowered)
+					}
+				}
+				if limit := hard[resourceName]; total.Cmp(limit) > 0 {
+					messages = append(messages, fmt.Sprintf(
+						"exceeded tenant quota: %s, namespace %s: %s=%s, total: %s=%s, limited: %s=%s",
+						quota.Name,
+						to.Namespace, resourceName, requested.String(),
+						resourceName, total.String(),
+						resourceName, limit.String(),
+					))
+				}
+			}
+			if len(messages) > 0 {
+				return fmt.Errorf("invalid transfer: %s", strings.Join(messages, "; "))
+			}
+			if len(raised) == 0 {
+				return nil
+			}
+
+			lowerAllocation(&quota, rqName, from.Namespace, newFrom)
+			quota.Status.SetReservation(necotiatorv1beta1.QuotaReservation{
+				Namespace:     to.Namespace,
+				ResourceQuota: rqName,
+				Hard:          raised,
+				ExpiresAt:     metav1.NewTime(now.Add(necotiatorv1beta1.ReservationTTL)),
+			}, now)
+			return r.Status().Update(ctx, &quota)
+		})
+		if err != nil {
+			return err
+		}
+		name = parent
+	}
+	return nil
+}
+
+// lowerAllocation lowers the allocation of the namespace to the hard limits for the resource quotas of the name in the status.
+func lowerAllocation(quota *necotiatorv1beta1.TenantResourceQuota, name, namespace string, hard corev1.ResourceList) {
+	allocated := quota.Status.Allocated
+	if name != quota.GetResourceQuotaName() {
+		allocated = nil
+		for i := range quota.Status.ScopedQuotas {
+			if quota.Status.ScopedQuotas[i].Name == name {
+				allocated = quota.Status.ScopedQuotas[i].Allocated
+			}
+		}
+	}
+
+	for resourceName, usage := range allocated {
+		current, ok := usage.Namespaces[namespace]
+		quantity := hard[resourceName]
+		if !ok || quantity.Cmp(current) >= 0 {
+			continue
+		}
+		usage.Total.Sub(current)
+		usage.Total.Add(quantity)
+		usage.Namespaces[namespace] = quantity
+		allocated[resourceName] = usage
+	}
+}
+
+// updateHard adds the resources to the hard limits of the resource quota, or subtracts them if increase is false.
+func (r *QuotaTransferReconciler) updateHard(ctx context.Context, key client.ObjectKey, resources corev1.ResourceList, increase bool) error {
+	return updateResourceQuota(ctx, r.Client, key, func(rq *corev1.ResourceQuota) error {
+		for resourceName, quantity := range resources {
+			current := rq.Spec.Hard[resourceName].DeepCopy()
+			if increase {
+				current.Add(quantity)
+			} else {
+				if current.Cmp(quantity) < 0 {
+					return fmt.Errorf("insufficient resource, requested: %s=%s, allocated: %s=%s", resourceName, quantity.String(), resourceName, current.String())
+				}
+				current.Sub(quantity)
+			}
+			rq.Spec.Hard[resourceName] = current
+		}
+		return nil
+	})
+}
+
+// finish records the result of the transfer in the status and an event on the tenant resource quota.
+// tenantQuota is nil if the tenant is unknown.
+func (r *QuotaTransferReconciler) finish(ctx context.Context, transfer *necotiatorv1beta1.QuotaTransfer, tenantQuota *necotiatorv1beta1.TenantResourceQuota, transferErr error) error {
+	logger := log.FromContext(ctx)
+
+	if tenantQuota != nil {
+		transfer.Status.Tenant = tenantQuota.Name
+	}
+	if transferErr != nil {
+		logger.Info("Quota transfer failed", "reason", transferErr.Error())
+		transfer.Status.Phase = necotiatorv1beta1.QuotaTransferFailed
+		transfer.Status.Message = transferErr.Error()
+	} else {
+		transfer.Status.Phase = necotiatorv1beta1.QuotaTransferSucceeded
+		transfer.Status.Message = fmt.Sprintf(
+			"Transferred %s from namespace %s to namespace %s",
+			formatResources(transfer.Spec.Resources), transfer.Namespace, transfer.Spec.To,
+		)
+	}
+
+	if tenantQuota != nil {
+		if transferErr != nil {
+			r.Recorder.Event(tenantQuota, corev1.EventTypeWarning, "QuotaTransferFailed", fmt.Sprintf(
+				"QuotaTransfer %s/%s failed: %s", transfer.Namespace, transfer.Name, transferErr.Error(),
+			))
+		} else {
+			r.Recorder.Event(tenantQuota, corev1.EventTypeNormal, "QuotaTransferred", fmt.Sprintf(
+				"QuotaTransfer %s/%s: %s", transfer.Namespace, transfer.Name, transfer.Status.Message,
+			))
+		}
+	}
+
+	// Retry on conflicts rather than returning the error, so that the transfer is not executed again.
+	status := transfer.Status
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		var latest necotiatorv1beta1.QuotaTransfer
+		if err := r.Get(ctx, client.ObjectKeyFromObject(transfer), &latest); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		latest.Status = status
+		return r.Status().Update(ctx, &latest)
+	})
+}
+
+func sortedResourceNames(resources corev1.ResourceList) []corev1.ResourceName {
+	names := make([]corev1.ResourceName, 0, len(resources))
+	for resourceName := range resources {
+		names = append(names, resourceName)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+func formatResources(resources corev1.ResourceList) string {
+	var pairs []string
+	for _, resourceName := range sortedResourceNames(resources) {
+		quantity := resources[resourceName]
+		pairs = append(pairs, fmt.Sprintf("%s=%s", resourceName, quantity.String()))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *QuotaTransferReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.apiReader = mgr.GetAPIReader()
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&necotiatorv1beta1.QuotaTransfer{}).
+		Complete(r)
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
+	"github.com/cybozu-go/necotiator/pkg/constants"
+)
+
+var _ = Describe("Test QuotaTransferController", func() {
+	ctx := context.Background()
+	var stopFunc func()
+	var tenantResourceQuotaName string
+	var fromNamespace string
+	var toNamespace string
+
+	BeforeEach(func() {
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             scheme,
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = (&TenantResourceQuotaReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   scheme,
+			Recorder: mgr.GetEventRecorderFor(constants.EventRecorderName),
+		}).SetupWithManager(ctx, mgr)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = (&QuotaTransferReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   scheme,
+			Recorder: mgr.GetEventRecorderFor(constants.EventRecorderName),
+		}).SetupWithManager(mgr)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(ctx)
+		stopFunc = cancel
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		tenantResourceQuotaName = newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.NamespaceDefaults = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("50m"),
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		fromNamespace = newTestObjectName()
+		toNamespace = newTestObjectName()
+		for _, name := range []string{fromNamespace, toNamespace} {
+			err = k8sClient.Create(ctx, newNamespace(name, teamName))
+			Expect(err).ShouldNot(HaveOccurred())
+
+			name := name
+			Eventually(func(g Gomega) {
+				var quota corev1.ResourceQuota
+				err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+					corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("50m")),
+				}))
+			}).Should(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		stopFunc()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	newQuotaTransfer := func(cpu string) *necotiatorv1beta1.QuotaTransfer {
+		return &necotiatorv1beta1.QuotaTransfer{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      newTestObjectName(),
+				Namespace: fromNamespace,
+			},
+			Spec: necotiatorv1beta1.QuotaTransferSpec{
+				To: toNamespace,
+				Resources: corev1.ResourceList{
+					"limits.cpu": resource.MustParse(cpu),
+				},
+			},
+		}
+	}
+
+	expectHard := func(namespace, cpu string) {
+		var quota corev1.ResourceQuota
+		err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: constants.ResourceQuotaNameDefault}, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+			corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse(cpu)),
+		}))
+	}
+
+	It("should transfer resources between namespaces of the same tenant", func() {
+		transfer := newQuotaTransfer("30m")
+		err := k8sClient.Create(ctx, transfer)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(transfer), transfer)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(transfer.Status).Should(MatchAllFields(Fields{
+				"Phase":   Equal(necotiatorv1beta1.QuotaTransferSucceeded),
+				"Tenant":  Equal(tenantResourceQuotaName),
+				"Message": Not(BeEmpty()),
+			}))
+		}).Should(Succeed())
+
+		expectHard(fromNamespace, "20m")
+		expectHard(toNamespace, "80m")
+
+		Eventually(func(g Gomega) {
+			var events corev1.EventList
+			err = k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(events.Items).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+					"Name": Equal(tenantResourceQuotaName),
+				}),
+				"Reason": Equal("QuotaTransferred"),
+			})))
+		}).Should(Succeed())
+	})
+
+	It("should fail to transfer more resources than allocated", func() {
+		transfer := newQuotaTransfer("80m")
+		err := k8sClient.Create(ctx, transfer)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(transfer), transfer)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(transfer.Status).Should(MatchAllFields(Fields{
+				"Phase":   Equal(necotiatorv1beta1.QuotaTransferFailed),
+				"Tenant":  Equal(tenantResourceQuotaName),
+				"Message": ContainSubstring("insufficient resource in namespace %s, requested: limits.cpu=80m, allocated: limits.cpu=50m", fromNamespace),
+			}))
+		}).Should(Succeed())
+
+		expectHard(fromNamespace, "50m")
+		expectHard(toNamespace, "50m")
+	})
+
+	It("should fail to transfer resources to namespace of other tenant", func() {
+		otherNamespace := newTestObjectName()
+		err := k8sClient.Create(ctx, newNamespace(otherNamespace, newTestObjectName()))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		transfer := newQuotaTransfer("30m")
+		transfer.Spec.To = otherNamespace
+		err = k8sClient.Create(ctx, transfer)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(transfer), transfer)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(transfer.Status.Phase).Should(Equal(necotiatorv1beta1.QuotaTransferFailed))
+			g.Expect(transfer.Status.Message).Should(Equal("namespace " + otherNamespace + " does not belong to tenant " + tenantResourceQuotaName))
+		}).Should(Succeed())
+
+		expectHard(fromNamespace, "50m")
+	})
+
+	It("should restore source keeping reservation when destination cannot be increased", func() {
+		var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		var from, to corev1.ResourceQuota
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: fromNamespace, Name: constants.ResourceQuotaNameDefault}, &from)
+		Expect(err).ShouldNot(HaveOccurred())
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: toNamespace, Name: constants.ResourceQuotaNameDefault}, &to)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		r := &QuotaTransferReconciler{
+			Client:    rejectingClient{Client: k8sClient, namespace: toNamespace},
+			Scheme:    scheme,
+			apiReader: k8sClient,
+		}
+		err = r.transfer(ctx, newQuotaTransfer("30m"), &tenantResourceQuota, &from, &to)
+		Expect(err).Should(MatchError(ContainSubstring("failed to increase resource quota in namespace " + toNamespace)))
+
+		expectHard(fromNamespace, "50m")
+		expectHard(toNamespace, "50m")
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(tenantResourceQuota.Status.Reservations).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Namespace":     Equal(toNamespace),
+			"ResourceQuota": Equal(constants.ResourceQuotaNameDefault),
+			"Hard": MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("80m")),
+			}),
+		})))
+	})
+})
+
+// rejectingClient rejects the updates of the resource quotas in the namespace.
+type rejectingClient struct {
+	client.Client
+	namespace string
+}
+
+func (c rejectingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if _, ok := obj.(*corev1.ResourceQuota); ok && obj.GetNamespace() == c.namespace {
+		return apierrors.NewForbidden(corev1.Resource("resourcequotas"), obj.GetName(), errors.New("rejected for test"))
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
@@ -19,18 +19,33 @@ package controllers
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -42,21 +57,40 @@ import (
 
 	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
 	"github.com/cybozu-go/necotiator/pkg/constants"
+	"github.com/cybozu-go/necotiator/pkg/fieldowner"
+	"github.com/cybozu-go/necotiator/pkg/resourcename"
 )
 
+// errNotManaged is returned when the resource quota is not managed by the tenant.
+var errNotManaged = errors.New("resource quota is not managed by the tenant")
+
+// errLeaseApplied is returned when the lease is already applied to the resource quota, or already reverted if reverting.
+var errLeaseApplied = errors.New("lease is already applied to the resource quota")
+
+// discoveryInterval is how long the discovered resources are cached to expand the hard patterns.
+const discoveryInterval = 10 * time.Minute
+
 // TenantResourceQuotaReconciler reconciles a TenantResourceQuota object
 type TenantResourceQuotaReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// Discovery finds the namespaced resources to expand the hard patterns of object counts.
+	// It is created from the config of the manager if not set.
+	Discovery    discovery.CachedDiscoveryInterface
+	discoveredAt time.Time
+
+	apiReader client.Reader
 }
 
 //+kubebuilder:rbac:groups=necotiator.cybozu.io,resources=tenantresourcequotas,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=necotiator.cybozu.io,resources=tenantresourcequotas/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=necotiator.cybozu.io,resources=tenantresourcequotas/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=resourcequotas,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;update;patch
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -79,6 +113,9 @@ func (r *TenantResourceQuotaReconciler) Reconcile(ctx context.Context, req ctrl.
 	if !quota.DeletionTimestamp.IsZero() {
 		if controllerutil.ContainsFinalizer(&quota, constants.Finalizer) {
 			if err := r.removeLabel(ctx, &quota); err != nil {
+				if err := r.updateErrorStatus(ctx, &quota, err); err != nil {
+					logger.Error(err, "Failed to update status for reconcile error")
+				}
 				return ctrl.Result{}, err
 			}
 			controllerutil.RemoveFinalizer(&quota, constants.Finalizer)
@@ -89,195 +126,1907 @@ func (r *TenantResourceQuotaReconciler) Reconcile(ctx context.Context, req ctrl.
 		return ctrl.Result{}, nil
 	}
 
+	err = r.reconcile(ctx, &quota)
+	if isConflict(err) {
+		// The admission webhook records reservations in the status concurrently with the controller,
+		// so the conflicts are retried without reporting them as errors.
+		logger.Info("Requeue after conflict", "error", err.Error())
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if err != nil {
+		if err := r.updateErrorStatus(ctx, &quota, err); err != nil {
+			logger.Error(err, "Failed to update status for reconcile error")
+		}
+		return ctrl.Result{}, err
+	}
+
+	next, ok := quota.NextHardChange(time.Now())
+	if reclaim, found := quota.NextReclaim(); found && (!ok || reclaim.Before(next)) {
+		next, ok = reclaim, true
+	}
+	if ok {
+		return ctrl.Result{RequeueAfter: time.Until(next)}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *TenantResourceQuotaReconciler) reconcile(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota) error {
+	logger := log.FromContext(ctx)
+
+	if err := r.startReconciling(ctx, quota); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+
 	var namespaces corev1.NamespaceList
 
 	selector, err := metav1.LabelSelectorAsSelector(quota.Spec.NamespaceSelector)
 	if err != nil {
-		return ctrl.Result{}, err
+		return fmt.Errorf("invalid namespace selector: %w", err)
 	}
 
 	err = r.List(ctx, &namespaces, &client.ListOptions{
 		LabelSelector: selector,
 	})
 	if err != nil {
-		return ctrl.Result{}, err
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	var quotas necotiatorv1beta1.TenantResourceQuotaList
+	err = r.List(ctx, &quotas)
+	if err != nil {
+		return fmt.Errorf("failed to list tenant resource quotas: %w", err)
 	}
 
+	var owned []corev1.Namespace
+	var conflicts []necotiatorv1beta1.NamespaceConflict
 	for _, ns := range namespaces.Items {
-		err := r.reconcileResourceQuota(ctx, &quota, &ns)
+		owner, tenants := namespaceOwner(&ns, quotas.Items)
+		for _, tenant := range tenants {
+			if tenant == quota.Name {
+				continue
+			}
+			conflicts = append(conflicts, necotiatorv1beta1.NamespaceConflict{
+				Namespace: ns.Name,
+				Tenant:    tenant,
+				Owner:     owner,
+			})
+		}
+		if owner != quota.Name {
+			logger.Info("Skip namespace owned by other tenant", "namespace", ns.Name, "owner", owner)
+			continue
+		}
+		owned = append(owned, ns)
+	}
+	namespaces.Items = owned
+
+	// Keep reconciling the other namespaces even if one of them fails,
+	// so that a single broken namespace does not block the whole tenant.
+	var allocations map[string]corev1.ResourceList
+	if quota.IsDynamic() {
+		allocations, err = r.dynamicAllocations(ctx, quota, namespaces.Items)
 		if err != nil {
-			return ctrl.Result{}, err
+			return fmt.Errorf("failed to compute dynamic allocations: %w", err)
+		}
+	}
+
+	var errs []error
+	expanded, err := r.expandHardPatterns(ctx, quota, namespaces.Items)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to expand hard patterns: %w", err))
+	}
+	remaining := remainingResources(quota)
+	for _, ns := range lowerAllocationsFirst(quota, namespaces.Items, allocations) {
+		err := r.labelNamespace(ctx, quota, &ns)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to label namespace %s: %w", ns.Name, err))
+			continue
+		}
+		err = r.reconcileResourceQuota(ctx, quota, &ns, remaining, allocations[ns.Name], expanded)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to reconcile resource quota in namespace %s: %w", ns.Name, err))
+			continue
+		}
+		for i := range quota.Spec.ScopedQuotas {
+			scopedQuota := &quota.Spec.ScopedQuotas[i]
+			err := r.reconcileScopedResourceQuota(ctx, quota, &ns, scopedQuota)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to reconcile resource quota %s in namespace %s: %w", scopedQuota.Name, ns.Name, err))
+			}
 		}
 		logger.Info("Reconciled", "namespace", ns.GetName())
 	}
 
-	if err := r.removeLabelOnUnmatched(ctx, &quota, &namespaces); err != nil {
-		return ctrl.Result{}, err
+	if err := r.reconcileLeases(ctx, quota, &namespaces, time.Now()); err != nil {
+		errs = append(errs, fmt.Errorf("failed to reconcile leases: %w", err))
+	}
+
+	if err := r.reconcileReclaim(ctx, quota, &namespaces, time.Now()); err != nil {
+		errs = append(errs, fmt.Errorf("failed to reclaim idle allocations: %w", err))
+	}
+
+	if err := r.removeLabelOnUnmatched(ctx, quota, &namespaces); err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove label from unmatched resource quotas: %w", err))
+	}
+
+	// The status is updated even on a partial failure, so that the allocations of the reconciled namespaces
+	// are not checked against the stale status by the admission webhook.
+	reconcileErr := utilerrors.NewAggregate(errs)
+	err = r.updateStatus(ctx, quota, &namespaces, conflicts, reconcileErr)
+	if err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	if reconcileErr != nil {
+		return reconcileErr
+	}
+
+	logger.Info("Reconciling", "namespaces", namespaces)
+
+	return nil
+}
+
+// reconcileLeases adds the active namespace leases to the managed resource quotas and reverts the others.
+// The applied leases are recorded in the status after each change, so that a lease is never added twice.
+func (r *TenantResourceQuotaReconciler) reconcileLeases(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, namespaceList *corev1.NamespaceList, now time.Time) error {
+	selected := make(map[string]bool)
+	for _, ns := range namespaceList.Items {
+		selected[ns.Name] = true
+	}
+
+	desired := make(map[string]necotiatorv1beta1.AppliedQuotaLease)
+	for _, lease := range tenantQuota.Spec.Leases {
+		if lease.Namespace == "" || !lease.IsActive(now) || !selected[lease.Namespace] {
+			continue
+		}
+		desired[lease.Name] = necotiatorv1beta1.AppliedQuotaLease{
+			Name:      lease.Name,
+			Namespace: lease.Namespace,
+			Hard:      lease.Hard,
+		}
+	}
+
+	applied := append([]necotiatorv1beta1.AppliedQuotaLease(nil), tenantQuota.Status.Leases...)
+	for _, lease := range tenantQuota.Status.Leases {
+		if d, ok := desired[lease.Name]; ok && d.Namespace == lease.Namespace && equality.Semantic.DeepEqual(d.Hard, lease.Hard) {
+			delete(desired, lease.Name)
+			continue
+		}
+
+		if err := r.revertLease(ctx, tenantQuota, &lease); err != nil {
+			return fmt.Errorf("failed to revert lease %s: %w", lease.Name, err)
+		}
+		applied = removeAppliedLease(applied, lease.Name)
+		if err := r.updateLeaseStatus(ctx, tenantQuota, applied); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lease := desired[name]
+		if err := r.addLease(ctx, tenantQuota, &lease); err != nil {
+			return fmt.Errorf("failed to apply lease %s: %w", lease.Name, err)
+		}
+		applied = append(applied, lease)
+		if err := r.updateLeaseStatus(ctx, tenantQuota, applied); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addLease adds the hard limits of the lease to the managed resource quota of the namespace.
+// The lease is recorded in the annotation of the resource quota in the same update,
+// so that it is not added twice when the status of the tenant fails to be updated.
+func (r *TenantResourceQuotaReconciler) addLease(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, lease *necotiatorv1beta1.AppliedQuotaLease) error {
+	key := client.ObjectKey{Namespace: lease.Namespace, Name: tenantQuota.GetResourceQuotaName()}
+	err := updateResourceQuota(ctx, r.Client, key, func(rq *corev1.ResourceQuota) error {
+		names := appliedLeaseNames(rq)
+		if names.Has(lease.Name) {
+			return errLeaseApplied
+		}
+		for resourceName, quantity := range lease.Hard {
+			hard := rq.Spec.Hard[resourceName].DeepCopy()
+			hard.Add(quantity)
+			rq.Spec.Hard[resourceName] = hard
+		}
+		setAppliedLeaseNames(rq, names.Insert(lease.Name))
+		return nil
+	})
+	if errors.Is(err, errLeaseApplied) {
+		log.FromContext(ctx).Info("Skip applying lease already applied", "lease", lease.Name, "namespace", lease.Namespace)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Info("Applied lease", "lease", lease.Name, "namespace", lease.Namespace)
+	r.Recorder.Event(tenantQuota, corev1.EventTypeNormal, "LeaseApplied", fmt.Sprintf(
+		"Lease %s added %s to namespace %s", lease.Name, formatResources(lease.Hard), lease.Namespace,
+	))
+	return nil
+}
+
+// revertLease subtracts the hard limits of the lease from the managed resource quota of the namespace.
+// The hard limits are reverted even if the usage exceeds them, and the excess is reported by an event.
+// The resource quota no longer managed by the tenant, or without the lease in the annotation, is left as is.
+func (r *TenantResourceQuotaReconciler) revertLease(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, lease *necotiatorv1beta1.AppliedQuotaLease) error {
+	logger := log.FromContext(ctx)
+
+	key := client.ObjectKey{Namespace: lease.Namespace, Name: tenantQuota.GetResourceQuotaName()}
+	var overUsage []string
+	err := updateResourceQuota(ctx, r.Client, key, func(rq *corev1.ResourceQuota) error {
+		if rq.Labels[constants.LabelTenant] != tenantQuota.Name {
+			return errNotManaged
+		}
+		names := appliedLeaseNames(rq)
+		if !names.Has(lease.Name) {
+			return errLeaseApplied
+		}
+
+		overUsage = nil
+		for _, resourceName := range sortedResourceNames(lease.Hard) {
+			hard := rq.Spec.Hard[resourceName].DeepCopy()
+			hard.Sub(lease.Hard[resourceName])
+			if hard.Sign() < 0 {
+				hard = resource.MustParse("0")
+			}
+			rq.Spec.Hard[resourceName] = hard
+
+			if used, ok := rq.Status.Used[resourceName]; ok && used.Cmp(hard) > 0 {
+				overUsage = append(overUsage, fmt.Sprintf("%s (used: %s, hard: %s)", resourceName, used.String(), hard.String()))
+			}
+		}
+		setAppliedLeaseNames(rq, names.Delete(lease.Name))
+		return nil
+	})
+	if apierrors.IsNotFound(err) || errors.Is(err, errNotManaged) {
+		logger.Info("Skip reverting lease of unmanaged resource quota", "lease", lease.Name, "namespace", lease.Namespace)
+		return nil
+	}
+	if errors.Is(err, errLeaseApplied) {
+		logger.Info("Skip reverting lease already reverted", "lease", lease.Name, "namespace", lease.Namespace)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Reverted lease", "lease", lease.Name, "namespace", lease.Namespace)
+	r.Recorder.Event(tenantQuota, corev1.EventTypeNormal, "LeaseExpired", fmt.Sprintf(
+		"Lease %s removed %s from namespace %s", lease.Name, formatResources(lease.Hard), lease.Namespace,
+	))
+	if len(overUsage) > 0 {
+		r.Recorder.Event(tenantQuota, corev1.EventTypeWarning, "LeaseExpiredOverUsage", fmt.Sprintf(
+			"Usage of namespace %s exceeds the hard limits reverted by lease %s: %s",
+			lease.Namespace, lease.Name, strings.Join(overUsage, ", "),
+		))
+	}
+	return nil
+}
+
+// updateLeaseStatus records the applied leases in the status.
+func (r *TenantResourceQuotaReconciler) updateLeaseStatus(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, applied []necotiatorv1beta1.AppliedQuotaLease) error {
+	sort.Slice(applied, func(i, j int) bool { return applied[i].Name < applied[j].Name })
+	if len(applied) == 0 {
+		applied = nil
+	}
+	tenantQuota.Status.Leases = applied
+	return r.Status().Update(ctx, tenantQuota)
+}
+
+// appliedLeaseNames returns the names of the leases applied to the resource quota recorded in the annotation.
+func appliedLeaseNames(rq *corev1.ResourceQuota) sets.String {
+	names := sets.NewString()
+	if value := rq.Annotations[constants.AnnotationAppliedLeases]; value != "" {
+		names.Insert(strings.Split(value, ",")...)
+	}
+	return names
+}
+
+// setAppliedLeaseNames records the names of the leases applied to the resource quota in the annotation.
+func setAppliedLeaseNames(rq *corev1.ResourceQuota, names sets.String) {
+	if names.Len() == 0 {
+		delete(rq.Annotations, constants.AnnotationAppliedLeases)
+		return
+	}
+	if rq.Annotations == nil {
+		rq.Annotations = make(map[string]string)
+	}
+	rq.Annotations[constants.AnnotationAppliedLeases] = strings.Join(names.List(), ",")
+}
+
+func removeAppliedLease(leases []necotiatorv1beta1.AppliedQuotaLease, name string) []necotiatorv1beta1.AppliedQuotaLease {
+	var result []necotiatorv1beta1.AppliedQuotaLease
+	for _, lease := range leases {
+		if lease.Name != name {
+			result = append(result, lease)
+		}
+	}
+	return result
+}
+
+// reclaimKey identifies an allocation of a resource in a namespace.
+type reclaimKey struct {
+	namespace string
+	resource  corev1.ResourceName
+}
+
+// reconcileReclaim tracks the allocations unused beyond the headroom of the reclaim policy
+// and shrinks those idle for the idle period toward the usage plus the headroom.
+// Namespaces with applied leases and resources managed by other managers are not reclaimed.
+func (r *TenantResourceQuotaReconciler) reconcileReclaim(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, namespaceList *corev1.NamespaceList, now time.Time) error {
+	old := tenantQuota.Status.DeepCopy()
+	policy := tenantQuota.Spec.Reclaim
+
+	selected := make(map[string]bool)
+	for _, ns := range namespaceList.Items {
+		selected[ns.Name] = true
+	}
+	leased := make(map[string]bool)
+	for _, lease := range tenantQuota.Status.Leases {
+		leased[lease.Namespace] = true
+	}
+	since := make(map[reclaimKey]metav1.Time)
+	for _, idle := range tenantQuota.Status.Idle {
+		since[reclaimKey{idle.Namespace, idle.Resource}] = idle.Since
+	}
+	reclaimed := make(map[reclaimKey]necotiatorv1beta1.ReclaimedAllocation)
+	for _, allocation := range tenantQuota.Status.Reclaimed {
+		if selected[allocation.Namespace] {
+			reclaimed[reclaimKey{allocation.Namespace, allocation.Resource}] = allocation
+		}
+	}
+
+	var idle []necotiatorv1beta1.IdleAllocation
+	for _, ns := range namespaceList.Items {
+		if policy == nil || leased[ns.Name] {
+			continue
+		}
+
+		var rq corev1.ResourceQuota
+		err := r.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: tenantQuota.GetResourceQuotaName()}, &rq)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if rq.Labels[constants.LabelTenant] != tenantQuota.Name {
+			continue
+		}
+		fieldset, err := foreignManagedFields(tenantQuota, &rq)
+		if err != nil {
+			return err
+		}
+
+		due := make(map[corev1.ResourceName]bool)
+		for _, resourceName := range sortedResourceNames(tenantQuota.Spec.Hard) {
+			if fieldset.Has(fieldpath.MakePathOrDie("spec", "hard", string(resourceName))) {
+				continue
+			}
+			hard, ok := rq.Spec.Hard[resourceName]
+			if !ok {
+				continue
+			}
+			used, ok := rq.Status.Used[resourceName]
+			if !ok {
+				continue
+			}
+			if hard.Cmp(reclaimTarget(tenantQuota, resourceName, used)) <= 0 {
+				continue
+			}
+
+			key := reclaimKey{ns.Name, resourceName}
+			idleSince, ok := since[key]
+			if !ok {
+				idleSince = metav1.NewTime(now)
+			}
+			if now.Before(idleSince.Add(policy.IdlePeriod.Duration)) {
+				idle = append(idle, necotiatorv1beta1.IdleAllocation{
+					Namespace: ns.Name,
+					Resource:  resourceName,
+					Since:     idleSince,
+				})
+				continue
+			}
+			due[resourceName] = true
+		}
+		if len(due) == 0 {
+			continue
+		}
+
+		allocations, err := r.reclaim(ctx, tenantQuota, client.ObjectKeyFromObject(&rq), due, now)
+		if err != nil {
+			return fmt.Errorf("failed to reclaim resources from namespace %s: %w", ns.Name, err)
+		}
+		for _, allocation := range allocations {
+			reclaimed[reclaimKey{allocation.Namespace, allocation.Resource}] = allocation
+		}
+	}
+
+	tenantQuota.Status.Idle = idle
+	tenantQuota.Status.Reclaimed = nil
+	for _, allocation := range reclaimed {
+		tenantQuota.Status.Reclaimed = append(tenantQuota.Status.Reclaimed, allocation)
+	}
+	sort.Slice(tenantQuota.Status.Reclaimed, func(i, j int) bool {
+		a, b := tenantQuota.Status.Reclaimed[i], tenantQuota.Status.Reclaimed[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Resource < b.Resource
+	})
+
+	if equality.Semantic.DeepEqual(old, &tenantQuota.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, tenantQuota)
+}
+
+// reclaimTarget returns the hard limit of the resource left to a namespace on reclamation.
+// The target is not lowered below the minimum of the namespace limits.
+func reclaimTarget(tenantQuota *necotiatorv1beta1.TenantResourceQuota, resourceName corev1.ResourceName, used resource.Quantity) resource.Quantity {
+	target := tenantQuota.Spec.Reclaim.Target(used)
+	if limits := tenantQuota.Spec.NamespaceLimits; limits != nil {
+		if minHard, ok := limits.Min[resourceName]; ok && target.Cmp(minHard) < 0 {
+			target = minHard.DeepCopy()
+		}
+	}
+	return target
+}
+
+// reclaim shrinks the hard limits of the resources in the managed resource quota to the reclaim target.
+// The target is computed from the latest usage, so a resource whose usage has grown meanwhile is left as is.
+func (r *TenantResourceQuotaReconciler) reclaim(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, key client.ObjectKey, resources map[corev1.ResourceName]bool, now time.Time) ([]necotiatorv1beta1.ReclaimedAllocation, error) {
+	var allocations []necotiatorv1beta1.ReclaimedAllocation
+	err := updateResourceQuota(ctx, r.Client, key, func(rq *corev1.ResourceQuota) error {
+		if rq.Labels[constants.LabelTenant] != tenantQuota.Name {
+			return errNotManaged
+		}
+
+		allocations = nil
+		for _, resourceName := range sortedResourceNames(rq.Spec.Hard) {
+			if !resources[resourceName] {
+				continue
+			}
+			hard := rq.Spec.Hard[resourceName]
+			target := reclaimTarget(tenantQuota, resourceName, rq.Status.Used[resourceName])
+			if hard.Cmp(target) <= 0 {
+				continue
+			}
+			quantity := hard.DeepCopy()
+			quantity.Sub(target)
+			rq.Spec.Hard[resourceName] = target
+			allocations = append(allocations, necotiatorv1beta1.ReclaimedAllocation{
+				Namespace:   key.Namespace,
+				Resource:    resourceName,
+				Quantity:    quantity,
+				Hard:        target,
+				ReclaimedAt: metav1.NewTime(now),
+			})
+		}
+		return nil
+	})
+	if apierrors.IsNotFound(err) || errors.Is(err, errNotManaged) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, allocation := range allocations {
+		log.FromContext(ctx).Info("Reclaimed idle allocation", "namespace", allocation.Namespace, "resource", allocation.Resource, "quantity", allocation.Quantity.String())
+		r.Recorder.Event(tenantQuota, corev1.EventTypeNormal, "QuotaReclaimed", fmt.Sprintf(
+			"Reclaimed %s=%s from namespace %s unused for %s: hard: %s=%s",
+			allocation.Resource, allocation.Quantity.String(), allocation.Namespace, tenantQuota.Spec.Reclaim.IdlePeriod.Duration,
+			allocation.Resource, allocation.Hard.String(),
+		))
+	}
+	return allocations, nil
+}
+
+// updateErrorStatus records the reconcile error in the conditions of the latest tenant resource quota.
+func (r *TenantResourceQuotaReconciler) updateErrorStatus(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, reconcileErr error) error {
+	var latest necotiatorv1beta1.TenantResourceQuota
+	err := r.Get(ctx, client.ObjectKeyFromObject(tenantQuota), &latest)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	old := latest.DeepCopy()
+	setErrorConditions(&latest, reconcileErr)
+
+	if equality.Semantic.DeepEqual(old.Status, latest.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, &latest)
+}
+
+// namespaceOwner returns the name of the tenant owning the namespace and the names of all tenants selecting the namespace.
+// The tenant with the highest priority owns the namespace, and the tenant with the lexicographically smallest name wins a tie.
+// Tenants being deleted do not select namespaces anymore.
+func namespaceOwner(ns *corev1.Namespace, quotas []necotiatorv1beta1.TenantResourceQuota) (string, []string) {
+	var candidates []*necotiatorv1beta1.TenantResourceQuota
+	for i := range quotas {
+		if !quotas[i].DeletionTimestamp.IsZero() {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(quotas[i].Spec.NamespaceSelector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			candidates = append(candidates, &quotas[i])
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Spec.Priority != candidates[j].Spec.Priority {
+			return candidates[i].Spec.Priority > candidates[j].Spec.Priority
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	tenants := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		tenants[i] = candidate.Name
+	}
+	return tenants[0], tenants
+}
+
+func (r *TenantResourceQuotaReconciler) removeLabel(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota) error {
+	var resourceQuotaList corev1.ResourceQuotaList
+
+	err := r.List(ctx, &resourceQuotaList, &client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			constants.LabelTenant: quota.GetName(),
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, resourceQuota := range resourceQuotaList.Items {
+		delete(resourceQuota.Labels, constants.LabelCreatedBy)
+		delete(resourceQuota.Labels, constants.LabelTenant)
+		err = r.Update(ctx, &resourceQuota)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.removeNamespaceLabel(ctx, quota, nil)
+}
+
+// labelNamespace labels the namespace owned by the tenant with the name of the tenant.
+// The label scopes the webhooks for pods and persistent volume claims to the namespaces of tenants.
+func (r *TenantResourceQuotaReconciler) labelNamespace(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota, ns *corev1.Namespace) error {
+	if ns.Labels[constants.LabelTenant] == quota.Name {
+		return nil
+	}
+	patch := client.MergeFrom(ns.DeepCopy())
+	if ns.Labels == nil {
+		ns.Labels = make(map[string]string)
+	}
+	ns.Labels[constants.LabelTenant] = quota.Name
+	return r.Patch(ctx, ns, patch)
+}
+
+// removeNamespaceLabel removes the label of the tenant from the namespaces not in matched.
+func (r *TenantResourceQuotaReconciler) removeNamespaceLabel(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota, matched map[string]bool) error {
+	var namespaces corev1.NamespaceList
+	err := r.List(ctx, &namespaces, client.MatchingLabels{constants.LabelTenant: quota.Name})
+	if err != nil {
+		return err
+	}
+
+	for _, ns := range namespaces.Items {
+		if matched[ns.Name] {
+			continue
+		}
+		patch := client.MergeFrom(ns.DeepCopy())
+		delete(ns.Labels, constants.LabelTenant)
+		err = r.Patch(ctx, &ns, patch)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// managesResourceQuota returns true if the resource quota of the name is managed by the tenant resource quota.
+func managesResourceQuota(quota *necotiatorv1beta1.TenantResourceQuota, name string) bool {
+	if name == quota.GetResourceQuotaName() {
+		return true
+	}
+	for _, scopedQuota := range quota.Spec.ScopedQuotas {
+		if scopedQuota.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *TenantResourceQuotaReconciler) removeLabelOnUnmatched(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota, namespaceList *corev1.NamespaceList) error {
+	logger := log.FromContext(ctx)
+
+	var resourceQuotaList corev1.ResourceQuotaList
+
+	err := r.List(ctx, &resourceQuotaList, &client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			constants.LabelTenant: quota.GetName(),
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	matched := make(map[string]bool)
+	for _, namespace := range namespaceList.Items {
+		matched[namespace.Name] = true
+	}
+
+	for _, resourceQuota := range resourceQuotaList.Items {
+		if matched[resourceQuota.Namespace] && managesResourceQuota(quota, resourceQuota.Name) {
+			continue
+		}
+		logger.Info("Removing label from the selector unmatched resource quota", "namespace", resourceQuota.Namespace, "name", resourceQuota.Name)
+		delete(resourceQuota.Labels, constants.LabelCreatedBy)
+		delete(resourceQuota.Labels, constants.LabelTenant)
+		err = r.Update(ctx, &resourceQuota)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.removeNamespaceLabel(ctx, quota, matched)
+}
+
+// updateStatus records the allocations and the usage of the namespaces in the status.
+// reconcileErr is the error of the partially failed reconciliation, or nil if the reconciliation succeeded.
+func (r *TenantResourceQuotaReconciler) updateStatus(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, namespaceList *corev1.NamespaceList, conflicts []necotiatorv1beta1.NamespaceConflict, reconcileErr error) error {
+	allocated := make(map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage)
+	used := make(map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage)
+	var violations []necotiatorv1beta1.NamespaceLimitViolation
+	var fieldOwners []necotiatorv1beta1.NamespaceFieldOwners
+	var missing []necotiatorv1beta1.MissingResource
+	scopedStatuses := make([]necotiatorv1beta1.ScopedQuotaStatus, len(tenantQuota.Spec.ScopedQuotas))
+	for i, scopedQuota := range tenantQuota.Spec.ScopedQuotas {
+		scopedStatuses[i] = necotiatorv1beta1.ScopedQuotaStatus{
+			Name:      scopedQuota.Name,
+			Allocated: make(map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage),
+			Used:      make(map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage),
+		}
+	}
+
+	for _, namespace := range namespaceList.Items {
+		for i := range scopedStatuses {
+			var quota corev1.ResourceQuota
+			err := r.Get(ctx, client.ObjectKey{Namespace: namespace.Name, Name: scopedStatuses[i].Name}, &quota)
+			if err != nil {
+				return err
+			}
+			if quota.Labels[constants.LabelTenant] != tenantQuota.Name {
+				continue
+			}
+			scopedHard := tenantQuota.Spec.ScopedQuotas[i].Hard
+			addResourceUsage(scopedStatuses[i].Allocated, resourcename.Translate(quota.Status.Hard, scopedHard), namespace.Name)
+			addResourceUsage(scopedStatuses[i].Used, resourcename.Translate(quota.Status.Used, scopedHard), namespace.Name)
+			missing = addMissingResources(missing, scopedHard, &quota)
+		}
+
+		var quota corev1.ResourceQuota
+		err := r.Get(ctx, client.ObjectKey{Namespace: namespace.Name, Name: tenantQuota.GetResourceQuotaName()}, &quota)
+		if err != nil {
+			return err
+		}
+		if quota.Labels[constants.LabelTenant] != tenantQuota.Name {
+			log.FromContext(ctx).Error(nil, "Ignore unmatched label namespace", "namespace", namespace.Name)
+			r.Recorder.Event(tenantQuota, corev1.EventTypeWarning, "IgnoredNamespace", fmt.Sprintf("Ignored unmatched label namespace: %s", namespace.Name))
+			continue
+		}
+
+		statusHard := resourcename.Translate(quota.Status.Hard, tenantQuota.Spec.Hard)
+		addResourceUsage(allocated, statusHard, namespace.Name)
+		addResourceUsage(used, resourcename.Translate(quota.Status.Used, tenantQuota.Spec.Hard), namespace.Name)
+		missing = addMissingResources(missing, tenantQuota.Spec.Hard, &quota)
+		owners, err := fieldowner.HardOwners(&quota)
+		if err != nil {
+			return err
+		}
+		if len(owners) > 0 {
+			fieldOwners = append(fieldOwners, necotiatorv1beta1.NamespaceFieldOwners{
+				Namespace: namespace.Name,
+				Hard:      joinOwners(owners),
+			})
+		}
+		violations = append(violations, namespaceLimitViolations(tenantQuota.Spec.NamespaceLimits, statusHard, namespace.Name)...)
+	}
+
+	children, err := r.listChildren(ctx, tenantQuota)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		mergeResourceUsage(allocated, child.Status.Allocated)
+		mergeResourceUsage(used, child.Status.Used)
+		for _, childStatus := range child.Status.ScopedQuotas {
+			for i := range scopedStatuses {
+				if scopedStatuses[i].Name != childStatus.Name {
+					continue
+				}
+				mergeResourceUsage(scopedStatuses[i].Allocated, childStatus.Allocated)
+				mergeResourceUsage(scopedStatuses[i].Used, childStatus.Used)
+			}
+		}
+	}
+
+	setPatternUsage(allocated, tenantQuota.Spec.HardPatterns)
+	setPatternUsage(used, tenantQuota.Spec.HardPatterns)
+
+	old := tenantQuota.DeepCopy()
+
+	tenantQuota.Status.Allocated = allocated
+	tenantQuota.Status.Used = used
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Namespace != violations[j].Namespace {
+			return violations[i].Namespace < violations[j].Namespace
+		}
+		return violations[i].Resource < violations[j].Resource
+	})
+	tenantQuota.Status.NamespaceLimitViolations = violations
+	if tenantQuota.Spec.EnforcementMode != necotiatorv1beta1.EnforcementDryRun {
+		tenantQuota.Status.DryRunViolations = nil
+	}
+	sort.Slice(fieldOwners, func(i, j int) bool { return fieldOwners[i].Namespace < fieldOwners[j].Namespace })
+	tenantQuota.Status.FieldOwners = fieldOwners
+	if len(scopedStatuses) == 0 {
+		scopedStatuses = nil
+	}
+	tenantQuota.Status.ScopedQuotas = scopedStatuses
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Namespace != conflicts[j].Namespace {
+			return conflicts[i].Namespace < conflicts[j].Namespace
+		}
+		return conflicts[i].Tenant < conflicts[j].Tenant
+	})
+	tenantQuota.Status.Conflicts = conflicts
+	now := time.Now()
+	pruneReservations(tenantQuota, now)
+	tenantQuota.Status.MissingResources = missingResourcesSince(&old.Status, missing, now)
+	tenantQuota.Status.EffectiveHard = tenantQuota.EffectiveHard(now)
+	tenantQuota.Status.Schedule = ""
+	if schedule := tenantQuota.ActiveSchedule(now); schedule != nil {
+		tenantQuota.Status.Schedule = schedule.Name
+	}
+	if tenantQuota.Status.Schedule != old.Status.Schedule {
+		r.Recorder.Event(tenantQuota, corev1.EventTypeNormal, "ScheduleChanged", fmt.Sprintf(
+			"Effective schedule changed from %q to %q", old.Status.Schedule, tenantQuota.Status.Schedule,
+		))
+	}
+	setConflictCondition(tenantQuota)
+	switch {
+	case reconcileErr == nil:
+		tenantQuota.Status.ObservedGeneration = tenantQuota.Generation
+		setReconciledConditions(tenantQuota)
+	case !isConflict(reconcileErr):
+		setReconciledConditions(tenantQuota)
+		setErrorConditions(tenantQuota, reconcileErr)
+	}
+	setUsageCondition(tenantQuota)
+	if meta.IsStatusConditionTrue(tenantQuota.Status.Conditions, necotiatorv1beta1.ConditionUsageAboveThreshold) &&
+		!meta.IsStatusConditionTrue(old.Status.Conditions, necotiatorv1beta1.ConditionUsageAboveThreshold) {
+		condition := meta.FindStatusCondition(tenantQuota.Status.Conditions, necotiatorv1beta1.ConditionUsageAboveThreshold)
+		r.Recorder.Event(tenantQuota, corev1.EventTypeWarning, "UsageAboveThreshold", condition.Message)
+	}
+
+	if equality.Semantic.DeepEqual(old.Status, tenantQuota.Status) {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Updating status")
+	err = r.Status().Update(ctx, tenantQuota)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addMissingResources adds the namespace of the resource quota to the missing resources for each resource of hard absent in it.
+// Resources with equivalent names in the resource quota are not missing.
+func addMissingResources(missing []necotiatorv1beta1.MissingResource, hard corev1.ResourceList, quota *corev1.ResourceQuota) []necotiatorv1beta1.MissingResource {
+	for _, resourceName := range sortedResourceNames(hard) {
+		if _, ok := resourcename.Lookup(quota.Spec.Hard, resourceName); ok {
+			continue
+		}
+		found := false
+		for i := range missing {
+			if missing[i].ResourceQuota == quota.Name && missing[i].Resource == resourceName {
+				missing[i].Namespaces = append(missing[i].Namespaces, quota.Namespace)
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, necotiatorv1beta1.MissingResource{
+				ResourceQuota: quota.Name,
+				Resource:      resourceName,
+				Namespaces:    []string{quota.Namespace},
+			})
+		}
+	}
+	return missing
+}
+
+// missingResourcesSince keeps the time when each namespace was first observed lacking each resource,
+// groups the namespaces of each missing resource by the time, and sorts the missing resources.
+func missingResourcesSince(old *necotiatorv1beta1.TenantResourceQuotaStatus, missing []necotiatorv1beta1.MissingResource, now time.Time) []necotiatorv1beta1.MissingResource {
+	var result []necotiatorv1beta1.MissingResource
+	for _, m := range missing {
+		for _, namespace := range m.Namespaces {
+			since, ok := old.MissingSince(m.ResourceQuota, m.Resource, namespace)
+			if !ok {
+				since = metav1.NewTime(now)
+			}
+			found := false
+			for i := range result {
+				if result[i].ResourceQuota == m.ResourceQuota && result[i].Resource == m.Resource && result[i].Since.Equal(&since) {
+					result[i].Namespaces = append(result[i].Namespaces, namespace)
+					found = true
+				}
+			}
+			if !found {
+				result = append(result, necotiatorv1beta1.MissingResource{
+					ResourceQuota: m.ResourceQuota,
+					Resource:      m.Resource,
+					Namespaces:    []string{namespace},
+					Since:         since,
+				})
+			}
+		}
+	}
+	for i := range result {
+		sort.Strings(result[i].Namespaces)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ResourceQuota != result[j].ResourceQuota {
+			return result[i].ResourceQuota < result[j].ResourceQuota
+		}
+		if result[i].Resource != result[j].Resource {
+			return result[i].Resource < result[j].Resource
+		}
+		return result[i].Since.Before(&result[j].Since)
+	})
+	return result
+}
+
+// pruneReservations removes the reservations of the webhook expired or observed in the allocation of the tenant.
+func pruneReservations(tenantQuota *necotiatorv1beta1.TenantResourceQuota, now time.Time) {
+	var reservations []necotiatorv1beta1.QuotaReservation
+	for _, reservation := range tenantQuota.Status.Reservations {
+		if !reservation.IsActive(now) {
+			continue
+		}
+		allocated := tenantQuota.Status.Allocated
+		if reservation.ResourceQuota != tenantQuota.GetResourceQuotaName() {
+			allocated = nil
+			for _, status := range tenantQuota.Status.ScopedQuotas {
+				if status.Name == reservation.ResourceQuota {
+					allocated = status.Allocated
+				}
+			}
+		}
+		for resourceName, reserved := range reservation.Hard {
+			if reserved.Cmp(allocated[resourceName].Namespaces[reservation.Namespace]) > 0 {
+				reservations = append(reservations, reservation)
+				break
+			}
+		}
+	}
+	tenantQuota.Status.Reservations = reservations
+}
+
+// joinOwners joins the field managers of each resource with commas.
+func joinOwners(owners map[corev1.ResourceName][]string) map[corev1.ResourceName]string {
+	joined := make(map[corev1.ResourceName]string, len(owners))
+	for resourceName, managers := range owners {
+		joined[resourceName] = strings.Join(managers, ",")
+	}
+	return joined
+}
+
+// startReconciling sets the Reconciling condition to true when the controller starts working on a new generation of the spec.
+func (r *TenantResourceQuotaReconciler) startReconciling(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota) error {
+	if tenantQuota.Status.ObservedGeneration == tenantQuota.Generation {
+		return nil
+	}
+	condition := meta.FindStatusCondition(tenantQuota.Status.Conditions, necotiatorv1beta1.ConditionReconciling)
+	if condition != nil && condition.Status == metav1.ConditionTrue && condition.ObservedGeneration == tenantQuota.Generation {
+		return nil
+	}
+
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionReconciling,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "Progressing",
+		Message:            fmt.Sprintf("Reconciling generation %d", tenantQuota.Generation),
+	})
+	return r.Status().Update(ctx, tenantQuota)
+}
+
+// isConflict returns true if the error is caused only by conflicts with concurrent updates.
+func isConflict(err error) bool {
+	var aggregate utilerrors.Aggregate
+	if errors.As(err, &aggregate) {
+		for _, err := range aggregate.Errors() {
+			if !isConflict(err) {
+				return false
+			}
+		}
+		return len(aggregate.Errors()) > 0
+	}
+	return apierrors.IsConflict(err)
+}
+
+// setErrorConditions sets the conditions for a failed reconciliation.
+func setErrorConditions(tenantQuota *necotiatorv1beta1.TenantResourceQuota, reconcileErr error) {
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "ReconcileFailed",
+		Message:            reconcileErr.Error(),
+	})
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionReconciling,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "RetryingAfterError",
+		Message:            "Reconciliation will be retried",
+	})
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "ReconcileFailed",
+		Message:            reconcileErr.Error(),
+	})
+}
+
+// setReconciledConditions sets the conditions for a successful reconciliation.
+func setReconciledConditions(tenantQuota *necotiatorv1beta1.TenantResourceQuota) {
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "Reconciled",
+		Message:            "All resource quotas are reconciled",
+	})
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionReconciling,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "Reconciled",
+		Message:            "The latest spec is reconciled",
+	})
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "Reconciled",
+		Message:            "No error occurred in the last reconciliation",
+	})
+
+	var overAllocated []string
+	for resourceName, hard := range tenantQuota.AllocatableHard(time.Now()) {
+		usage, ok := tenantQuota.Status.Allocated[resourceName]
+		if !ok || usage.Total.Cmp(hard) <= 0 {
+			continue
+		}
+		overAllocated = append(overAllocated, fmt.Sprintf("%s (allocated: %s, hard: %s)", resourceName, usage.Total.String(), hard.String()))
+	}
+	for pattern, hard := range tenantQuota.Spec.HardPatterns {
+		usage, ok := tenantQuota.Status.Allocated[pattern]
+		if !ok || usage.Total.Cmp(hard) <= 0 {
+			continue
+		}
+		overAllocated = append(overAllocated, fmt.Sprintf("%s (allocated: %s, hard: %s)", pattern, usage.Total.String(), hard.String()))
+	}
+	for i, scopedQuota := range tenantQuota.Spec.ScopedQuotas {
+		if i >= len(tenantQuota.Status.ScopedQuotas) {
+			break
+		}
+		for resourceName, hard := range scopedQuota.Hard {
+			usage, ok := tenantQuota.Status.ScopedQuotas[i].Allocated[resourceName]
+			if !ok || usage.Total.Cmp(hard) <= 0 {
+				continue
+			}
+			overAllocated = append(overAllocated, fmt.Sprintf("%s/%s (allocated: %s, hard: %s)", scopedQuota.Name, resourceName, usage.Total.String(), hard.String()))
+		}
+	}
+	if len(overAllocated) == 0 {
+		meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+			Type:               necotiatorv1beta1.ConditionOverAllocated,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: tenantQuota.Generation,
+			Reason:             "WithinHardLimits",
+			Message:            "Allocated resources are within the hard limits",
+		})
+		return
+	}
+	sort.Strings(overAllocated)
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionOverAllocated,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "AllocatedExceedsHard",
+		Message:            "Allocated resources exceed the hard limits: " + strings.Join(overAllocated, ", "),
+	})
+}
+
+// setUsageCondition sets the UsageAboveThreshold condition if the usage guard is configured.
+func setUsageCondition(tenantQuota *necotiatorv1beta1.TenantResourceQuota) {
+	threshold := tenantQuota.UsageThreshold(time.Now())
+	if threshold == nil {
+		meta.RemoveStatusCondition(&tenantQuota.Status.Conditions, necotiatorv1beta1.ConditionUsageAboveThreshold)
+		return
+	}
+
+	var aboveThreshold []string
+	for resourceName, limit := range threshold {
+		usage, ok := tenantQuota.Status.Used[resourceName]
+		if !ok || usage.Total.Cmp(limit) < 0 {
+			continue
+		}
+		aboveThreshold = append(aboveThreshold, fmt.Sprintf("%s (used: %s, threshold: %s)", resourceName, usage.Total.String(), limit.String()))
+	}
+	if len(aboveThreshold) == 0 {
+		meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+			Type:               necotiatorv1beta1.ConditionUsageAboveThreshold,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: tenantQuota.Generation,
+			Reason:             "BelowThreshold",
+			Message:            "Usage is below the threshold",
+		})
+		return
+	}
+	sort.Strings(aboveThreshold)
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionUsageAboveThreshold,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "UsageAboveThreshold",
+		Message:            "Usage is above the threshold: " + strings.Join(aboveThreshold, ", "),
+	})
+}
+
+// setConflictCondition sets the NamespaceConflict condition from the conflicts in the status.
+func setConflictCondition(tenantQuota *necotiatorv1beta1.TenantResourceQuota) {
+	conflicts := tenantQuota.Status.Conflicts
+	if len(conflicts) == 0 {
+		meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+			Type:               necotiatorv1beta1.ConditionNamespaceConflict,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: tenantQuota.Generation,
+			Reason:             "NoConflict",
+			Message:            "No namespace is selected by other tenants",
+		})
+		return
+	}
+
+	messages := make([]string, len(conflicts))
+	for i, conflict := range conflicts {
+		messages[i] = fmt.Sprintf("namespace %s is also selected by %s (owner: %s)", conflict.Namespace, conflict.Tenant, conflict.Owner)
+	}
+	meta.SetStatusCondition(&tenantQuota.Status.Conditions, metav1.Condition{
+		Type:               necotiatorv1beta1.ConditionNamespaceConflict,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: tenantQuota.Generation,
+		Reason:             "NamespaceSelectedByMultipleTenants",
+		Message:            strings.Join(messages, "; "),
+	})
+}
+
+// listChildren returns the tenant resource quotas whose parent is the given tenant.
+// If the parent chain of the tenant is circular, it reports the cycle and returns no children
+// so that the aggregation does not include the tenant's own namespaces repeatedly.
+func (r *TenantResourceQuotaReconciler) listChildren(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota) ([]necotiatorv1beta1.TenantResourceQuota, error) {
+	var quotas necotiatorv1beta1.TenantResourceQuotaList
+	err := r.List(ctx, &quotas)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[string]string)
+	for _, quota := range quotas.Items {
+		parents[quota.Name] = quota.Spec.Parent
+	}
+	visited := map[string]bool{tenantQuota.Name: true}
+	for parentName := tenantQuota.Spec.Parent; parentName != ""; parentName = parents[parentName] {
+		if visited[parentName] {
+			log.FromContext(ctx).Error(nil, "Circular parent reference", "parent", parentName)
+			r.Recorder.Event(tenantQuota, corev1.EventTypeWarning, "CircularParent", fmt.Sprintf("Circular parent reference: %s", parentName))
+			return nil, nil
+		}
+		visited[parentName] = true
+	}
+
+	var children []necotiatorv1beta1.TenantResourceQuota
+	for _, quota := range quotas.Items {
+		if quota.Spec.Parent == tenantQuota.Name {
+			children = append(children, quota)
+		}
+	}
+	return children, nil
+}
+
+func addResourceUsage(usageMap map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage, resourceList corev1.ResourceList, namespaceName string) {
+	for resourceName, hard := range resourceList {
+		if usage, ok := usageMap[resourceName]; !ok {
+			usageMap[resourceName] = necotiatorv1beta1.ResourceUsage{
+				Total: hard,
+				Namespaces: map[string]resource.Quantity{
+					namespaceName: hard,
+				}}
+		} else {
+			usage.Total.Add(hard)
+			usage.Namespaces[namespaceName] = hard
+			usageMap[resourceName] = usage
+		}
+	}
+}
+
+// namespaceLimitViolations returns the resources of the namespace allocated out of the namespace limits.
+func namespaceLimitViolations(limits *necotiatorv1beta1.NamespaceLimits, resourceList corev1.ResourceList, namespaceName string) []necotiatorv1beta1.NamespaceLimitViolation {
+	if limits == nil {
+		return nil
+	}
+
+	var violations []necotiatorv1beta1.NamespaceLimitViolation
+	for resourceName, hard := range resourceList {
+		if minHard, ok := limits.Min[resourceName]; ok && !hard.IsZero() && hard.Cmp(minHard) < 0 {
+			violations = append(violations, necotiatorv1beta1.NamespaceLimitViolation{
+				Namespace: namespaceName,
+				Resource:  resourceName,
+				Type:      necotiatorv1beta1.NamespaceLimitMin,
+				Allocated: hard,
+				Limit:     minHard,
+			})
+		}
+		if maxHard, ok := limits.Max[resourceName]; ok && hard.Cmp(maxHard) > 0 {
+			violations = append(violations, necotiatorv1beta1.NamespaceLimitViolation{
+				Namespace: namespaceName,
+				Resource:  resourceName,
+				Type:      necotiatorv1beta1.NamespaceLimitMax,
+				Allocated: hard,
+				Limit:     maxHard,
+			})
+		}
+	}
+	return violations
+}
+
+// setPatternUsage replaces the usages of the patterns in usageMap with the totals of the matching resources in each namespace,
+// so that the child tenants are totaled with the hard patterns of the parent.
+func setPatternUsage(usageMap map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage, patterns corev1.ResourceList) {
+	namespaces := make(map[string]corev1.ResourceList)
+	for resourceName, usage := range usageMap {
+		if resourcename.IsPattern(resourceName) {
+			delete(usageMap, resourceName)
+			continue
+		}
+		for namespaceName, quantity := range usage.Namespaces {
+			if namespaces[namespaceName] == nil {
+				namespaces[namespaceName] = make(corev1.ResourceList)
+			}
+			namespaces[namespaceName][resourceName] = quantity
+		}
+	}
+	for namespaceName, resourceList := range namespaces {
+		addResourceUsage(usageMap, resourcename.Totals(resourceList, patterns), namespaceName)
+	}
+}
+
+// mergeResourceUsage adds per-namespace usages of a child tenant to usageMap.
+func mergeResourceUsage(usageMap map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage, childUsageMap map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage) {
+	for resourceName, usage := range childUsageMap {
+		for namespaceName, quantity := range usage.Namespaces {
+			if _, ok := usageMap[resourceName].Namespaces[namespaceName]; ok {
+				continue
+			}
+			addResourceUsage(usageMap, corev1.ResourceList{resourceName: quantity}, namespaceName)
+		}
+	}
+}
+
+// remainingResources returns the resources and the hard patterns not yet allocated to any namespace in the tenant.
+func remainingResources(tenantQuota *necotiatorv1beta1.TenantResourceQuota) corev1.ResourceList {
+	remaining := make(corev1.ResourceList)
+	for resourceName, hard := range tenantQuota.AllocatableHard(time.Now()) {
+		quantity := hard.DeepCopy()
+		if allocated, ok := tenantQuota.Status.Allocated[resourceName]; ok {
+			quantity.Sub(allocated.Total)
+		}
+		remaining[resourceName] = quantity
+	}
+	for pattern, hard := range tenantQuota.Spec.HardPatterns {
+		quantity := hard.DeepCopy()
+		if allocated, ok := tenantQuota.Status.Allocated[pattern]; ok {
+			quantity.Sub(allocated.Total)
+		}
+		remaining[pattern] = quantity
+	}
+	return remaining
+}
+
+// lowerAllocationsFirst returns the namespaces ordered so that the namespaces whose dynamic allocation is lowered come first.
+// The freed resources are then available to the namespaces whose allocation is raised in the same reconciliation.
+func lowerAllocationsFirst(tenantQuota *necotiatorv1beta1.TenantResourceQuota, namespaces []corev1.Namespace, allocations map[string]corev1.ResourceList) []corev1.Namespace {
+	lowered := func(ns string) bool {
+		for resourceName, quantity := range allocations[ns] {
+			if last, ok := lastAllocation(tenantQuota.Status.Allocated, ns, resourceName); ok && quantity.Cmp(last) < 0 {
+				return true
+			}
+		}
+		return false
+	}
+	sorted := append([]corev1.Namespace(nil), namespaces...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return lowered(sorted[i].Name) && !lowered(sorted[j].Name)
+	})
+	return sorted
+}
+
+// namespaceDefault returns the hard limit of the resource granted to a newly selected namespace.
+// The default is adjusted to be within the namespace limits, and resources without defaults are not granted.
+func namespaceDefault(tenantQuota *necotiatorv1beta1.TenantResourceQuota, resourceName corev1.ResourceName) resource.Quantity {
+	defaultHard, ok := tenantQuota.Spec.NamespaceDefaults[resourceName]
+	if !ok {
+		return resource.Quantity{}
+	}
+	defaultHard = defaultHard.DeepCopy()
+	limits := tenantQuota.Spec.NamespaceLimits
+	if limits == nil {
+		return defaultHard
+	}
+	if minHard, ok := limits.Min[resourceName]; ok && defaultHard.Cmp(minHard) < 0 {
+		defaultHard = minHard.DeepCopy()
+	}
+	if maxHard, ok := limits.Max[resourceName]; ok && defaultHard.Cmp(maxHard) > 0 {
+		defaultHard = maxHard.DeepCopy()
+	}
+	return defaultHard
+}
+
+// dynamicAllocations computes the hard limits of each namespace under the Dynamic allocation policy.
+// Each namespace gets its usage first, and the rest of the allocatable hard limits is shared by the namespace weights.
+// Hard limits managed by other managers are pinned and left out of the share,
+// and the applied namespace leases are added on top of the share of the namespace.
+// The share of each namespace is kept within the namespace limits.
+func (r *TenantResourceQuotaReconciler) dynamicAllocations(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, namespaces []corev1.Namespace) (map[string]corev1.ResourceList, error) {
+	quotas := make([]corev1.ResourceQuota, len(namespaces))
+	pinned := make([]*fieldpath.Set, len(namespaces))
+	allocations := make(map[string]corev1.ResourceList, len(namespaces))
+	for i, ns := range namespaces {
+		err := r.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: tenantQuota.GetResourceQuotaName()}, &quotas[i])
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		pinned[i], err = foreignManagedFields(tenantQuota, &quotas[i])
+		if err != nil {
+			return nil, err
+		}
+		allocations[ns.Name] = make(corev1.ResourceList)
+	}
+
+	leased := make(map[string]corev1.ResourceList)
+	for _, lease := range tenantQuota.Status.Leases {
+		if leased[lease.Namespace] == nil {
+			leased[lease.Namespace] = make(corev1.ResourceList)
+		}
+		for resourceName, quantity := range lease.Hard {
+			total := leased[lease.Namespace][resourceName].DeepCopy()
+			total.Add(quantity)
+			leased[lease.Namespace][resourceName] = total
+		}
+	}
+
+	for resourceName, pool := range tenantQuota.AllocatableHard(time.Now()) {
+		available := pool.MilliValue()
+		// Keep whole units for resources limited in whole units such as memory.
+		unit := int64(1)
+		if available%1000 == 0 {
+			unit = 1000
+		}
+		var sharing []int
+		var demands, weights, mins, maxes []int64
+		for i, ns := range namespaces {
+			var leaseMilli int64
+			if lease, ok := leased[ns.Name][resourceName]; ok {
+				leaseMilli = lease.MilliValue()
+				available -= leaseMilli
+			}
+			if pinned[i].Has(fieldpath.MakePathOrDie("spec", "hard", string(resourceName))) {
+				if hard, ok := quotas[i].Spec.Hard[resourceName]; ok {
+					available -= hard.MilliValue()
+				}
+				continue
+			}
+			used := quotas[i].Status.Used[resourceName]
+			minShare, maxShare := int64(0), int64(-1)
+			if limits := tenantQuota.Spec.NamespaceLimits; limits != nil {
+				if minHard, ok := limits.Min[resourceName]; ok && minHard.MilliValue() > leaseMilli {
+					minShare = minHard.MilliValue() - leaseMilli
+				}
+				if maxHard, ok := limits.Max[resourceName]; ok {
+					maxShare = 0
+					if maxHard.MilliValue() > leaseMilli {
+						maxShare = maxHard.MilliValue() - leaseMilli
+					}
+				}
+			}
+			sharing = append(sharing, i)
+			demands = append(demands, used.MilliValue())
+			weights = append(weights, tenantQuota.NamespaceWeight(ns.Name))
+			mins = append(mins, minShare)
+			maxes = append(maxes, maxShare)
+		}
+
+		shares := shareAllocation(available, unit, demands, weights, mins, maxes)
+		for j, i := range sharing {
+			hard := *resource.NewMilliQuantity(shares[j], pool.Format)
+			if lease, ok := leased[namespaces[i].Name][resourceName]; ok {
+				hard.Add(lease)
+			}
+			if limits := tenantQuota.Spec.NamespaceLimits; limits != nil {
+				if maxHard, ok := limits.Max[resourceName]; ok && hard.Cmp(maxHard) > 0 {
+					hard = maxHard.DeepCopy()
+				}
+			}
+			allocations[namespaces[i].Name][resourceName] = hard
+		}
+	}
+	return allocations, nil
+}
+
+// shareAllocation divides available among the namespaces with the demands and the weights in multiples of unit.
+// Each namespace gets its demand raised to its minimum first, and the rest is shared in proportion to the weights.
+// A share never exceeds the maximum of the namespace, and the amount trimmed by the maximum is shared among the others.
+// A negative maximum means no limit.
+// If available does not cover the demands, it is shared in proportion to the demands.
+func shareAllocation(available, unit int64, demands, weights, mins, maxes []int64) []int64 {
+	shares := make([]int64, len(demands))
+	if available <= 0 {
+		return shares
+	}
+
+	var totalBase int64
+	for i := range demands {
+		base := demands[i]
+		if mins[i] > base {
+			base = mins[i]
+		}
+		// Round up so that rounding to units never takes a share below its demand.
+		if base%unit != 0 {
+			base += unit - base%unit
+		}
+		if maxes[i] >= 0 && base > maxes[i] {
+			base = maxes[i]
+		}
+		shares[i] = base
+		totalBase += base
+	}
+	if totalBase >= available {
+		for i := range shares {
+			share := mulDiv(available, shares[i], totalBase)
+			shares[i] = share - share%unit
+		}
+		return shares
+	}
+
+	rest := available - totalBase
+	capped := make([]bool, len(demands))
+	for {
+		var totalWeight int64
+		for i := range weights {
+			if !capped[i] {
+				totalWeight += weights[i]
+			}
+		}
+		if totalWeight == 0 {
+			return shares
+		}
+
+		trimmed := false
+		for i := range weights {
+			if capped[i] || maxes[i] < 0 {
+				continue
+			}
+			if shares[i]+mulDiv(rest, weights[i], totalWeight) >= maxes[i] {
+				rest -= maxes[i] - shares[i]
+				shares[i] = maxes[i]
+				capped[i] = true
+				trimmed = true
+			}
+		}
+		if trimmed {
+			continue
+		}
+
+		for i := range weights {
+			if !capped[i] {
+				share := mulDiv(rest, weights[i], totalWeight)
+				shares[i] += share - share%unit
+			}
+		}
+		return shares
+	}
+}
+
+// mulDiv returns a * b / c without overflow of the intermediate product.
+func mulDiv(a, b, c int64) int64 {
+	product := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	return product.Div(product, big.NewInt(c)).Int64()
+}
+
+// expandHardPatterns returns the sorted resources matching the hard patterns of the tenant.
+// The candidates are the resources of the storage classes, the object counts of the namespaced resources served by the API server,
+// and the resources in the managed resource quotas of the namespaces, which include the extended resources set by the administrators.
+func (r *TenantResourceQuotaReconciler) expandHardPatterns(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, namespaces []corev1.Namespace) ([]corev1.ResourceName, error) {
+	if len(tenantQuota.Spec.HardPatterns) == 0 {
+		return nil, nil
+	}
+
+	var candidates []corev1.ResourceName
+	var storageClasses storagev1.StorageClassList
+	err := r.List(ctx, &storageClasses)
+	if err != nil {
+		return nil, err
+	}
+	for _, storageClass := range storageClasses.Items {
+		candidates = append(candidates,
+			corev1.ResourceName(storageClass.Name+storageClassSuffix+string(corev1.ResourceRequestsStorage)),
+			corev1.ResourceName(storageClass.Name+storageClassSuffix+string(corev1.ResourcePersistentVolumeClaims)),
+		)
+	}
+
+	counts, err := r.objectCountResources()
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, counts...)
+
+	for _, ns := range namespaces {
+		var quota corev1.ResourceQuota
+		err := r.Get(ctx, client.ObjectKey{Namespace: ns.Name, Name: tenantQuota.GetResourceQuotaName()}, &quota)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, sortedResourceNames(quota.Spec.Hard)...)
+	}
+
+	return resourcename.Expand(tenantQuota.Spec.HardPatterns, candidates), nil
+}
+
+// storageClassSuffix is the suffix of the storage class name in the resources of storage classes.
+const storageClassSuffix = ".storageclass.storage.k8s.io/"
+
+// objectCountResources returns the object count resources of the namespaced resources served by the API server.
+// Subresources and virtual resources that cannot be listed are excluded.
+// The discovered resources are cached for discoveryInterval, and the groups failing discovery are skipped.
+func (r *TenantResourceQuotaReconciler) objectCountResources() ([]corev1.ResourceName, error) {
+	if time.Since(r.discoveredAt) > discoveryInterval {
+		r.Discovery.Invalidate()
+		r.discoveredAt = time.Now()
+	}
+	lists, err := r.Discovery.ServerPreferredNamespacedResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+
+	var counts []corev1.ResourceName
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, apiResource := range list.APIResources {
+			if strings.Contains(apiResource.Name, "/") || !sets.NewString(apiResource.Verbs...).HasAll("create", "list") {
+				continue
+			}
+			name := "count/" + apiResource.Name
+			if gv.Group != "" {
+				name += "." + gv.Group
+			}
+			counts = append(counts, corev1.ResourceName(name))
+		}
+	}
+	return counts, nil
+}
+
+// reconcileResourceQuota applies the managed resource quota to the namespace.
+// Defaults granted to the namespace are subtracted from remaining.
+// allocation is the hard limits computed under the Dynamic allocation policy, or nil under the Manual allocation policy.
+// expanded is the resources expanded from the hard patterns, which are managed in the same way as the hard limits.
+func (r *TenantResourceQuotaReconciler) reconcileResourceQuota(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, ns *corev1.Namespace, remaining corev1.ResourceList, allocation corev1.ResourceList, expanded []corev1.ResourceName) error {
+	logger := log.FromContext(ctx)
+
+	var currentQuota corev1.ResourceQuota
+	err := r.Get(ctx, client.ObjectKey{Namespace: ns.GetName(), Name: tenantQuota.GetResourceQuotaName()}, &currentQuota)
+	if client.IgnoreNotFound(err) != nil {
+		return err
 	}
 
-	err = r.updateStatus(ctx, &quota, &namespaces)
+	tenantLabel := currentQuota.Labels[constants.LabelTenant]
+	takenOver := tenantLabel != "" && tenantLabel != tenantQuota.Name
+
+	hard := make(corev1.ResourceList)
+	fieldset, err := foreignManagedFields(tenantQuota, &currentQuota)
 	if err != nil {
-		return ctrl.Result{}, err
+		return err
 	}
 
-	logger.Info("Reconciling", "namespaces", namespaces)
+	currentHard := resourcename.Translate(currentQuota.Spec.Hard, tenantQuota.Spec.Hard)
+	resourceNames := sortedResourceNames(tenantQuota.Spec.Hard)
+	for _, resourceName := range expanded {
+		if _, ok := resourcename.Lookup(tenantQuota.Spec.Hard, resourceName); !ok {
+			resourceNames = append(resourceNames, resourceName)
+		}
+	}
+	recreated := false
+	for _, resourceName := range resourceNames {
+		if fieldset.Has(fieldpath.MakePathOrDie("spec", "hard", string(resourceName))) {
+			continue
+		}
+		if allocated, ok := allocation[resourceName]; ok {
+			hard[resourceName] = allocated
+			continue
+		}
+		if current, ok := currentHard[resourceName]; ok && tenantLabel == tenantQuota.Name {
+			hard[resourceName] = current
+			continue
+		}
+		if last, ok := lastAllocation(tenantQuota.Status.Allocated, ns.GetName(), resourceName); ok && currentQuota.UID == "" {
+			hard[resourceName] = last
+			recreated = true
+			continue
+		}
 
-	return ctrl.Result{}, nil
-}
+		limits := resourcename.Patterns(tenantQuota.Spec.HardPatterns, resourceName)
+		if _, ok := tenantQuota.Spec.Hard[resourceName]; ok {
+			limits = append([]corev1.ResourceName{resourceName}, limits...)
+		}
 
-func (r *TenantResourceQuotaReconciler) removeLabel(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota) error {
-	var resourceQuotaList corev1.ResourceQuotaList
+		// The resource quota taken over from another tenant keeps its hard limits within the remaining resources,
+		// so that the workloads in the namespace are not suddenly limited to zero.
+		if current, ok := currentHard[resourceName]; ok && takenOver {
+			kept := current.DeepCopy()
+			for _, limit := range limits {
+				if available := remaining[limit]; kept.Cmp(available) > 0 {
+					kept = available.DeepCopy()
+				}
+			}
+			if kept.Sign() < 0 {
+				kept = resource.MustParse("0")
+			}
+			hard[resourceName] = kept
+			for _, limit := range limits {
+				available := remaining[limit]
+				available.Sub(kept)
+				remaining[limit] = available
+			}
+			continue
+		}
 
-	err := r.List(ctx, &resourceQuotaList, &client.ListOptions{
-		LabelSelector: labels.SelectorFromSet(labels.Set{
-			constants.LabelTenant: quota.GetName(),
-		}),
-	})
-	if err != nil {
-		return err
+		hard[resourceName] = resource.MustParse("0")
+		defaultHard := namespaceDefault(tenantQuota, resourceName)
+		if defaultHard.IsZero() {
+			continue
+		}
+		granted := true
+		for _, limit := range limits {
+			if available := remaining[limit]; defaultHard.Cmp(available) > 0 {
+				logger.Info("Default is not granted because the tenant is full", "namespace", ns.GetName(), "resource", resourceName)
+				r.Recorder.Event(tenantQuota, corev1.EventTypeWarning, "DefaultNotGranted", fmt.Sprintf(
+					"Default %s=%s is not granted to namespace %s: tenant quota is full, remaining: %s=%s",
+					resourceName, defaultHard.String(), ns.GetName(), limit, available.String(),
+				))
+				granted = false
+				break
+			}
+		}
+		if !granted {
+			continue
+		}
+		hard[resourceName] = defaultHard
+		for _, limit := range limits {
+			available := remaining[limit]
+			available.Sub(defaultHard)
+			remaining[limit] = available
+		}
 	}
 
-	for _, resourceQuota := range resourceQuotaList.Items {
-		delete(resourceQuota.Labels, constants.LabelCreatedBy)
-		delete(resourceQuota.Labels, constants.LabelTenant)
-		err = r.Update(ctx, &resourceQuota)
-		if err != nil {
-			return err
-		}
+	if recreated {
+		r.recordRecreated(ctx, tenantQuota, ns.GetName(), tenantQuota.GetResourceQuotaName(), hard)
+	}
+	if takenOver {
+		r.recordTakenOver(ctx, tenantQuota, ns.GetName(), tenantLabel, hard)
+	}
+	if tenantLabel == tenantQuota.Name {
+		r.recordBackfilled(ctx, tenantQuota, &currentQuota, hard)
 	}
 
-	return nil
+	quota := applycorev1.ResourceQuota(tenantQuota.GetResourceQuotaName(), ns.GetName()).
+		WithLabels(map[string]string{
+			constants.LabelCreatedBy: constants.CreatedBy,
+			constants.LabelTenant:    tenantQuota.GetName(),
+		}).
+		WithSpec(applycorev1.ResourceQuotaSpec().WithHard(hard))
+
+	return r.applyResourceQuota(ctx, tenantQuota, &currentQuota, quota)
 }
 
-func (r *TenantResourceQuotaReconciler) removeLabelOnUnmatched(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota, namespaceList *corev1.NamespaceList) error {
+// reconcileScopedResourceQuota applies the resource quota of the scoped quota to the namespace.
+// Scoped quotas have no defaults, so a newly selected namespace gets zero for each resource.
+func (r *TenantResourceQuotaReconciler) reconcileScopedResourceQuota(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, ns *corev1.Namespace, scopedQuota *necotiatorv1beta1.ScopedQuota) error {
 	logger := log.FromContext(ctx)
 
-	var resourceQuotaList corev1.ResourceQuotaList
+	var currentQuota corev1.ResourceQuota
+	err := r.getResourceQuota(ctx, client.ObjectKey{Namespace: ns.GetName(), Name: scopedQuota.Name}, &currentQuota)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
 
-	err := r.List(ctx, &resourceQuotaList, &client.ListOptions{
-		LabelSelector: labels.SelectorFromSet(labels.Set{
-			constants.LabelTenant: quota.GetName(),
-		}),
-	})
+	tenantLabel := currentQuota.Labels[constants.LabelTenant]
+	hard := make(corev1.ResourceList)
+	fieldset, err := foreignManagedFields(tenantQuota, &currentQuota)
 	if err != nil {
 		return err
 	}
-
-	toRemove := make(map[string]corev1.ResourceQuota)
-	for _, resourceQuota := range resourceQuotaList.Items {
-		toRemove[resourceQuota.Namespace] = resourceQuota
+	var lastAllocated map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage
+	for _, status := range tenantQuota.Status.ScopedQuotas {
+		if status.Name == scopedQuota.Name {
+			lastAllocated = status.Allocated
+		}
 	}
-	for _, namespace := range namespaceList.Items {
-		delete(toRemove, namespace.Name)
+	currentHard := resourcename.Translate(currentQuota.Spec.Hard, scopedQuota.Hard)
+	recreated := false
+	for resourceName := range scopedQuota.Hard {
+		if fieldset.Has(fieldpath.MakePathOrDie("spec", "hard", string(resourceName))) {
+			continue
+		}
+		if current, ok := currentHard[resourceName]; ok && tenantLabel == tenantQuota.Name {
+			hard[resourceName] = current
+			continue
+		}
+		if last, ok := lastAllocation(lastAllocated, ns.GetName(), resourceName); ok && currentQuota.UID == "" {
+			hard[resourceName] = last
+			recreated = true
+			continue
+		}
+		hard[resourceName] = resource.MustParse("0")
+	}
+	if recreated {
+		r.recordRecreated(ctx, tenantQuota, ns.GetName(), scopedQuota.Name, hard)
+	}
+	if tenantLabel == tenantQuota.Name {
+		r.recordBackfilled(ctx, tenantQuota, &currentQuota, hard)
 	}
 
-	for _, resourceQuota := range toRemove {
-		logger.Info("Removing label from the selector unmatched resource quota", "namespace", resourceQuota.Namespace)
-		delete(resourceQuota.Labels, constants.LabelCreatedBy)
-		delete(resourceQuota.Labels, constants.LabelTenant)
-		err = r.Update(ctx, &resourceQuota)
+	// Scopes of a resource quota are immutable, so the resource quota is replaced with the current hard limits.
+	// The pinned values are kept in the replacement and given back to their field managers after it is created.
+	var pinnedOwners map[string]corev1.ResourceList
+	if currentQuota.UID != "" && !sameScopes(&currentQuota.Spec, scopedQuota) {
+		pinnedOwners, err = pinnedHardByManager(tenantQuota, &currentQuota)
 		if err != nil {
 			return err
 		}
+		for _, pinnedHard := range pinnedOwners {
+			for resourceName, quantity := range pinnedHard {
+				hard[resourceName] = quantity
+			}
+		}
+
+		logger.Info("Replacing resource quota to change scopes", "namespace", ns.GetName(), "name", scopedQuota.Name)
+		err = r.Delete(ctx, &currentQuota, client.Preconditions{UID: &currentQuota.UID})
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		currentQuota = corev1.ResourceQuota{}
 	}
 
-	return nil
-}
+	spec := applycorev1.ResourceQuotaSpec().
+		WithHard(hard).
+		WithScopes(scopedQuota.Scopes...)
+	if scopedQuota.ScopeSelector != nil {
+		selector := applycorev1.ScopeSelector()
+		for _, expr := range scopedQuota.ScopeSelector.MatchExpressions {
+			selector = selector.WithMatchExpressions(applycorev1.ScopedResourceSelectorRequirement().
+				WithScopeName(expr.ScopeName).
+				WithOperator(expr.Operator).
+				WithValues(expr.Values...))
+		}
+		spec = spec.WithScopeSelector(selector)
+	}
+	quota := applycorev1.ResourceQuota(scopedQuota.Name, ns.GetName()).
+		WithLabels(map[string]string{
+			constants.LabelCreatedBy: constants.CreatedBy,
+			constants.LabelTenant:    tenantQuota.GetName(),
+		}).
+		WithSpec(spec)
 
-func (r *TenantResourceQuotaReconciler) updateStatus(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, namespaceList *corev1.NamespaceList) error {
-	allocated := make(map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage)
-	used := make(map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage)
+	err = r.applyResourceQuota(ctx, tenantQuota, &currentQuota, quota)
+	if err != nil {
+		return err
+	}
 
-	for _, namespace := range namespaceList.Items {
-		var quota corev1.ResourceQuota
-		err := r.Get(ctx, client.ObjectKey{Namespace: namespace.Name, Name: constants.ResourceQuotaNameDefault}, &quota)
+	for manager, pinnedHard := range pinnedOwners {
+		pinnedQuota := applycorev1.ResourceQuota(scopedQuota.Name, ns.GetName()).
+			WithSpec(applycorev1.ResourceQuotaSpec().WithHard(pinnedHard))
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pinnedQuota)
 		if err != nil {
 			return err
 		}
-		if quota.Labels[constants.LabelTenant] != tenantQuota.Name {
-			log.FromContext(ctx).Error(nil, "Ignore unmatched label namespace", "namespace", namespace.Name)
-			r.Recorder.Event(tenantQuota, corev1.EventTypeWarning, "IgnoredNamespace", fmt.Sprintf("Ignored unmatched label namespace: %s", namespace.Name))
-			continue
+		err = r.Patch(ctx, &unstructured.Unstructured{Object: obj}, client.Apply, &client.PatchOptions{
+			FieldManager: manager,
+		})
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		addResourceUsage(allocated, quota.Status.Hard, namespace.Name)
-		addResourceUsage(used, quota.Status.Used, namespace.Name)
+// getResourceQuota gets the resource quota from the cache, or from the API server if the cache misses it.
+// The cache can miss a resource quota just replaced by the controller, which must not be taken as deleted.
+func (r *TenantResourceQuotaReconciler) getResourceQuota(ctx context.Context, key client.ObjectKey, rq *corev1.ResourceQuota) error {
+	err := r.Get(ctx, key, rq)
+	if !apierrors.IsNotFound(err) {
+		return err
 	}
+	return r.apiReader.Get(ctx, key, rq)
+}
 
-	old := tenantQuota.DeepCopy()
+// lastAllocation returns the last known allocation of the resource to the namespace recorded in the status.
+// It is used to recreate a deleted resource quota without resetting its hard limits to zero.
+func lastAllocation(allocated map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage, namespace string, resourceName corev1.ResourceName) (resource.Quantity, bool) {
+	quantity, ok := allocated[resourceName].Namespaces[namespace]
+	return quantity, ok
+}
 
-	tenantQuota.Status.Allocated = allocated
-	tenantQuota.Status.Used = used
+// recordRecreated reports the resource quota recreated with the last known allocation.
+func (r *TenantResourceQuotaReconciler) recordRecreated(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, namespace, name string, hard corev1.ResourceList) {
+	log.FromContext(ctx).Info("Recreating deleted resource quota with the last known allocation", "namespace", namespace, "name", name)
+	r.Recorder.Event(tenantQuota, corev1.EventTypeWarning, "ResourceQuotaRecreated", fmt.Sprintf(
+		"Resource quota %s/%s was deleted and recreated with the last known allocation: %s", namespace, name, formatResources(hard),
+	))
+}
 
-	if equality.Semantic.DeepEqual(old.Status, tenantQuota.Status) {
-		return nil
-	}
+// recordTakenOver reports the resource quota taken over from the previous owner of the namespace with the kept hard limits.
+func (r *TenantResourceQuotaReconciler) recordTakenOver(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, namespace, previous string, hard corev1.ResourceList) {
+	log.FromContext(ctx).Info("Taking over resource quota from other tenant", "namespace", namespace, "tenant", previous)
+	r.Recorder.Event(tenantQuota, corev1.EventTypeNormal, "NamespaceTakenOver", fmt.Sprintf(
+		"Namespace %s was taken over from tenant %s keeping the hard limits within the remaining resources: %s", namespace, previous, formatResources(hard),
+	))
+}
 
-	log.FromContext(ctx).Info("Updating status")
-	err := r.Status().Update(ctx, tenantQuota)
-	if err != nil {
-		return err
+// recordBackfilled reports the resources of hard added to the existing resource quota lacking them.
+func (r *TenantResourceQuotaReconciler) recordBackfilled(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, currentQuota *corev1.ResourceQuota, hard corev1.ResourceList) {
+	backfilled := make(corev1.ResourceList)
+	for resourceName, quantity := range hard {
+		if _, ok := resourcename.Lookup(currentQuota.Spec.Hard, resourceName); !ok {
+			backfilled[resourceName] = quantity
+		}
+	}
+	if currentQuota.UID == "" || len(backfilled) == 0 {
+		return
 	}
 
-	return nil
+	log.FromContext(ctx).Info("Backfilling missing resources", "namespace", currentQuota.Namespace, "name", currentQuota.Name, "resources", formatResources(backfilled))
+	r.Recorder.Event(tenantQuota, corev1.EventTypeNormal, "ResourceBackfilled", fmt.Sprintf(
+		"Backfilled missing resources of resource quota %s/%s: %s", currentQuota.Namespace, currentQuota.Name, formatResources(backfilled),
+	))
 }
 
-func addResourceUsage(usageMap map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage, resourceList corev1.ResourceList, namespaceName string) {
-	for resourceName, hard := range resourceList {
-		if usage, ok := usageMap[resourceName]; !ok {
-			usageMap[resourceName] = necotiatorv1beta1.ResourceUsage{
-				Total: hard,
-				Namespaces: map[string]resource.Quantity{
-					namespaceName: hard,
-				}}
-		} else {
-			usage.Total.Add(hard)
-			usage.Namespaces[namespaceName] = hard
-			usageMap[resourceName] = usage
+// sameScopes returns true if the resource quota has the same scopes as the scoped quota.
+func sameScopes(spec *corev1.ResourceQuotaSpec, scopedQuota *necotiatorv1beta1.ScopedQuota) bool {
+	if len(spec.Scopes) != len(scopedQuota.Scopes) {
+		return false
+	}
+	for i := range spec.Scopes {
+		if spec.Scopes[i] != scopedQuota.Scopes[i] {
+			return false
 		}
 	}
+	var selector, desired []corev1.ScopedResourceSelectorRequirement
+	if spec.ScopeSelector != nil {
+		selector = spec.ScopeSelector.MatchExpressions
+	}
+	if scopedQuota.ScopeSelector != nil {
+		desired = scopedQuota.ScopeSelector.MatchExpressions
+	}
+	return equality.Semantic.DeepEqual(selector, desired) || (len(selector) == 0 && len(desired) == 0)
 }
 
-func (r *TenantResourceQuotaReconciler) reconcileResourceQuota(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, ns *corev1.Namespace) error {
-	logger := log.FromContext(ctx)
-
-	var currentQuota corev1.ResourceQuota
-	err := r.Get(ctx, client.ObjectKey{Namespace: ns.GetName(), Name: constants.ResourceQuotaNameDefault}, &currentQuota)
-	if client.IgnoreNotFound(err) != nil {
-		return err
+// foreignManagedFields returns the fields of the resource quota managed by other managers than the controller.
+// The controller keeps the values of these fields as pinned values.
+// No field is pinned under the TakeOver field ownership policy,
+// and only the fields of the approved field managers are pinned under the Reject policy.
+func foreignManagedFields(tenantQuota *necotiatorv1beta1.TenantResourceQuota, currentQuota *corev1.ResourceQuota) (*fieldpath.Set, error) {
+	fieldset := &fieldpath.Set{}
+	managers, err := foreignManagedFieldsByManager(tenantQuota, currentQuota)
+	if err != nil {
+		return nil, err
 	}
-
-	tenantLabel := currentQuota.Labels[constants.LabelTenant]
-	if tenantLabel != "" && tenantLabel != tenantQuota.Name {
-		return nil
+	for _, fs := range managers {
+		fieldset = fieldset.Union(fs)
 	}
+	return fieldset, nil
+}
 
-	hard := make(corev1.ResourceList)
-	fieldset := &fieldpath.Set{}
+// foreignManagedFieldsByManager returns the fields of the resource quota pinned by each of the other managers than the controller.
+func foreignManagedFieldsByManager(tenantQuota *necotiatorv1beta1.TenantResourceQuota, currentQuota *corev1.ResourceQuota) (map[string]*fieldpath.Set, error) {
+	managers := make(map[string]*fieldpath.Set)
+	if tenantQuota.Spec.FieldOwnership == necotiatorv1beta1.FieldOwnershipTakeOver {
+		return managers, nil
+	}
 	for _, managedField := range currentQuota.GetManagedFields() {
 		if managedField.Manager == constants.ControllerName {
 			continue
 		}
+		if tenantQuota.Spec.FieldOwnership == necotiatorv1beta1.FieldOwnershipReject && !tenantQuota.IsApprovedFieldManager(managedField.Manager) {
+			continue
+		}
 		fs := &fieldpath.Set{}
-		err = fs.FromJSON(bytes.NewReader((managedField.FieldsV1.Raw)))
+		err := fs.FromJSON(bytes.NewReader((managedField.FieldsV1.Raw)))
 		if err != nil {
-			return err
+			return nil, err
 		}
-		fieldset = fieldset.Union(fs)
+		if managers[managedField.Manager] != nil {
+			fs = fs.Union(managers[managedField.Manager])
+		}
+		managers[managedField.Manager] = fs
 	}
+	return managers, nil
+}
 
-	for resourceName := range tenantQuota.Spec.Hard {
-		if !fieldset.Has(fieldpath.MakePathOrDie("spec", "hard", string(resourceName))) {
-			hard[resourceName] = resource.MustParse("0")
+// pinnedHardByManager returns the pinned hard limits of the resource quota by their field managers.
+func pinnedHardByManager(tenantQuota *necotiatorv1beta1.TenantResourceQuota, currentQuota *corev1.ResourceQuota) (map[string]corev1.ResourceList, error) {
+	managers, err := foreignManagedFieldsByManager(tenantQuota, currentQuota)
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[string]corev1.ResourceList)
+	for manager, fs := range managers {
+		for resourceName, quantity := range currentQuota.Spec.Hard {
+			if !fs.Has(fieldpath.MakePathOrDie("spec", "hard", string(resourceName))) {
+				continue
+			}
+			if owners[manager] == nil {
+				owners[manager] = make(corev1.ResourceList)
+			}
+			owners[manager][resourceName] = quantity
 		}
 	}
+	return owners, nil
+}
 
-	quota := applycorev1.ResourceQuota(constants.ResourceQuotaNameDefault, ns.GetName()).
-		WithLabels(map[string]string{
-			constants.LabelCreatedBy: constants.CreatedBy,
-			constants.LabelTenant:    tenantQuota.GetName(),
-		}).
-		WithSpec(applycorev1.ResourceQuotaSpec().WithHard(hard))
+// applyResourceQuota applies the resource quota with server-side apply if it differs from the current one.
+// The apply is forced to take over the fields of other managers unless the tenant respects them.
+func (r *TenantResourceQuotaReconciler) applyResourceQuota(ctx context.Context, tenantQuota *necotiatorv1beta1.TenantResourceQuota, currentQuota *corev1.ResourceQuota, quota *applycorev1.ResourceQuotaApplyConfiguration) error {
+	logger := log.FromContext(ctx)
 
 	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(quota)
 	if err != nil {
@@ -287,7 +2036,7 @@ func (r *TenantResourceQuotaReconciler) reconcileResourceQuota(ctx context.Conte
 		Object: obj,
 	}
 
-	currentApplyConfig, err := applycorev1.ExtractResourceQuota(&currentQuota, constants.ControllerName)
+	currentApplyConfig, err := applycorev1.ExtractResourceQuota(currentQuota, constants.ControllerName)
 	if err != nil {
 		return err
 	}
@@ -297,20 +2046,46 @@ func (r *TenantResourceQuotaReconciler) reconcileResourceQuota(ctx context.Conte
 	}
 
 	logger.Info("Reconciling resource quota", "resource quota", quota)
-	err = r.Patch(ctx, patch, client.Apply, &client.PatchOptions{
+	opts := &client.PatchOptions{
 		FieldManager: constants.ControllerName,
-	})
+	}
+	switch tenantQuota.Spec.FieldOwnership {
+	case necotiatorv1beta1.FieldOwnershipTakeOver, necotiatorv1beta1.FieldOwnershipReject:
+		opts.Force = pointer.Bool(true)
+	}
+	err = r.Patch(ctx, patch, client.Apply, opts)
 	if err != nil {
 		return err
 	}
 
 	return nil
+}
+
+// updateResourceQuota changes the resource quota by mutate and updates it, retrying on conflicts.
+// The update is owned by the controller so that the tenant resource quota keeps managing the new values.
+func updateResourceQuota(ctx context.Context, c client.Client, key client.ObjectKey, mutate func(*corev1.ResourceQuota) error) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		var rq corev1.ResourceQuota
+		err := c.Get(ctx, key, &rq)
+		if err != nil {
+			return err
+		}
+
+		if rq.Spec.Hard == nil {
+			rq.Spec.Hard = make(corev1.ResourceList)
+		}
+		if err := mutate(&rq); err != nil {
+			return err
+		}
 
+		return c.Update(ctx, &rq, client.FieldOwner(constants.ControllerName))
+	})
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *TenantResourceQuotaReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
 	logger := log.FromContext(ctx)
+	r.apiReader = mgr.GetAPIReader()
 
 	mapNamespace := func(o client.Object) []reconcile.Request {
 		var quotas necotiatorv1beta1.TenantResourceQuotaList
@@ -350,10 +2125,6 @@ func (r *TenantResourceQuotaReconciler) SetupWithManager(ctx context.Context, mg
 			}
 		}
 
-		if o.GetName() != constants.ResourceQuotaNameDefault {
-			return nil
-		}
-
 		var quotas necotiatorv1beta1.TenantResourceQuotaList
 		err := mgr.GetClient().List(ctx, &quotas)
 		if err != nil {
@@ -369,6 +2140,9 @@ func (r *TenantResourceQuotaReconciler) SetupWithManager(ctx context.Context, mg
 
 		var reqs []reconcile.Request
 		for _, quota := range quotas.Items {
+			if !managesResourceQuota(&quota, o.GetName()) {
+				continue
+			}
 			selector, err := metav1.LabelSelectorAsSelector(quota.Spec.NamespaceSelector)
 			if err != nil {
 				logger.Error(err, "parsing tenant resource quota selector")
@@ -386,9 +2160,107 @@ func (r *TenantResourceQuotaReconciler) SetupWithManager(ctx context.Context, mg
 		return reqs
 	}
 
+	mapChildTenantResourceQuota := func(o client.Object) []reconcile.Request {
+		quota, ok := o.(*necotiatorv1beta1.TenantResourceQuota)
+		if !ok || quota.Spec.Parent == "" {
+			return nil
+		}
+		return []reconcile.Request{
+			{
+				NamespacedName: types.NamespacedName{
+					Name: quota.Spec.Parent,
+				},
+			},
+		}
+	}
+
+	// Tenants selecting the same namespaces compete for their ownership, so a change of one requeues the others.
+	mapOverlappingTenantResourceQuota := func(o client.Object) []reconcile.Request {
+		quota, ok := o.(*necotiatorv1beta1.TenantResourceQuota)
+		if !ok {
+			return nil
+		}
+		selector, err := metav1.LabelSelectorAsSelector(quota.Spec.NamespaceSelector)
+		if err != nil {
+			logger.Error(err, "parsing tenant resource quota selector")
+			return nil
+		}
+		var namespaces corev1.NamespaceList
+		if err := mgr.GetClient().List(ctx, &namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			logger.Error(err, "watch tenant resource quota")
+			return nil
+		}
+		if len(namespaces.Items) == 0 {
+			return nil
+		}
+
+		var quotas necotiatorv1beta1.TenantResourceQuotaList
+		if err := mgr.GetClient().List(ctx, &quotas); err != nil {
+			logger.Error(err, "watch tenant resource quota")
+			return nil
+		}
+
+		var reqs []reconcile.Request
+		for _, other := range quotas.Items {
+			if other.GetName() == quota.GetName() {
+				continue
+			}
+			otherSelector, err := metav1.LabelSelectorAsSelector(other.Spec.NamespaceSelector)
+			if err != nil {
+				logger.Error(err, "parsing tenant resource quota selector")
+				continue
+			}
+			for _, ns := range namespaces.Items {
+				if otherSelector.Matches(labels.Set(ns.Labels)) {
+					reqs = append(reqs, reconcile.Request{
+						NamespacedName: types.NamespacedName{
+							Name: other.GetName(),
+						},
+					})
+					break
+				}
+			}
+		}
+
+		return reqs
+	}
+
+	mapStorageClass := func(o client.Object) []reconcile.Request {
+		var quotas necotiatorv1beta1.TenantResourceQuotaList
+		err := mgr.GetClient().List(ctx, &quotas)
+		if err != nil {
+			logger.Error(err, "watch storage class")
+			return nil
+		}
+
+		var reqs []reconcile.Request
+		for _, quota := range quotas.Items {
+			if len(quota.Spec.HardPatterns) == 0 {
+				continue
+			}
+			reqs = append(reqs, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name: quota.GetName(),
+				},
+			})
+		}
+		return reqs
+	}
+
+	if r.Discovery == nil {
+		dc, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		r.Discovery = memory.NewMemCacheClient(dc)
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&necotiatorv1beta1.TenantResourceQuota{}).
+		Watches(&source.Kind{Type: &necotiatorv1beta1.TenantResourceQuota{}}, handler.EnqueueRequestsFromMapFunc(mapChildTenantResourceQuota)).
+		Watches(&source.Kind{Type: &necotiatorv1beta1.TenantResourceQuota{}}, handler.EnqueueRequestsFromMapFunc(mapOverlappingTenantResourceQuota)).
 		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(mapNamespace)).
 		Watches(&source.Kind{Type: &corev1.ResourceQuota{}}, handler.EnqueueRequestsFromMapFunc(mapResourceQuota)).
+		Watches(&source.Kind{Type: &storagev1.StorageClass{}}, handler.EnqueueRequestsFromMapFunc(mapStorageClass)).
 		Complete(r)
 }
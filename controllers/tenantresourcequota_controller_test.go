@@ -10,7 +10,9 @@ import (
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gstruct"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -128,10 +130,795 @@ var _ = Describe("Test TenantResourceQuotaController", func() {
 			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
 				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("0")),
 			}))
+
+			var ns corev1.Namespace
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: name}, &ns)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(ns.Labels).Should(HaveKeyWithValue(constants.LabelTenant, tenantResourceQuotaName))
+		}).Should(Succeed())
+	})
+
+	It("should update TenantResourceQuota status", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name2 := newTestObjectName()
+		namespace2 := newNamespace(name2, teamName)
+		err = k8sClient.Create(ctx, namespace2)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name2, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+
+		var quota corev1.ResourceQuota
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+		quota.Status.Hard = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("0"),
+		}
+		quota.Status.Used = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("1"),
+		}
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name2, Name: constants.ResourceQuotaNameDefault}, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+		quota.Status.Hard = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("0"),
+		}
+		quota.Status.Used = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("100m"),
+		}
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(tenantResourceQuota.Status.Allocated).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): MatchAllFields(Fields{
+					"Total": SemanticEqual(resource.MustParse("0")),
+					"Namespaces": MatchAllKeys(Keys{
+						name:  SemanticEqual(resource.MustParse("0")),
+						name2: SemanticEqual(resource.MustParse("0")),
+					}),
+				}),
+			}))
+			g.Expect(tenantResourceQuota.Status.Used).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): MatchAllFields(Fields{
+					"Total": SemanticEqual(resource.MustParse("1100m")),
+					"Namespaces": MatchAllKeys(Keys{
+						name:  SemanticEqual(resource.MustParse("1")),
+						name2: SemanticEqual(resource.MustParse("100m")),
+					}),
+				}),
+			}))
+		}).Should(Succeed())
+	})
+
+	It("should set conditions and observed generation", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(tenantResourceQuota.Status.ObservedGeneration).Should(Equal(tenantResourceQuota.Generation))
+			g.Expect(meta.IsStatusConditionTrue(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionReady)).Should(BeTrue())
+			g.Expect(meta.IsStatusConditionFalse(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionReconciling)).Should(BeTrue())
+			g.Expect(meta.IsStatusConditionFalse(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionDegraded)).Should(BeTrue())
+			g.Expect(meta.IsStatusConditionFalse(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionOverAllocated)).Should(BeTrue())
+		}).Should(Succeed())
+
+		var quota corev1.ResourceQuota
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+		quota.Status.Hard = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("200m"),
+		}
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			condition := meta.FindStatusCondition(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionOverAllocated)
+			g.Expect(condition).ShouldNot(BeNil())
+			g.Expect(condition.Status).Should(Equal(metav1.ConditionTrue))
+			g.Expect(condition.Message).Should(ContainSubstring("limits.cpu"))
+		}).Should(Succeed())
+	})
+
+	It("should report usage above the threshold of usage guard", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.UsageGuard = &necotiatorv1beta1.UsageGuard{
+			ThresholdPercent: 50,
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var quota corev1.ResourceQuota
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+
+		quota.Status.Hard = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("100m"),
+		}
+		quota.Status.Used = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("60m"),
+		}
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			condition := meta.FindStatusCondition(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionUsageAboveThreshold)
+			g.Expect(condition).ShouldNot(BeNil())
+			g.Expect(condition.Status).Should(Equal(metav1.ConditionTrue))
+			g.Expect(condition.Message).Should(ContainSubstring("limits.cpu (used: 60m, threshold: 50m)"))
+		}).Should(Succeed())
+	})
+
+	It("should report reconcile errors in conditions", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, newTestObjectName())
+		tenantResourceQuota.Spec.NamespaceSelector.MatchExpressions = []metav1.LabelSelectorRequirement{
+			{Key: "team", Operator: "Invalid"},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(tenantResourceQuota.Status.ObservedGeneration).Should(BeZero())
+			g.Expect(meta.IsStatusConditionFalse(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionReady)).Should(BeTrue())
+			g.Expect(meta.IsStatusConditionTrue(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionReconciling)).Should(BeTrue())
+			condition := meta.FindStatusCondition(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionDegraded)
+			g.Expect(condition).ShouldNot(BeNil())
+			g.Expect(condition.Status).Should(Equal(metav1.ConditionTrue))
+			g.Expect(condition.Message).Should(ContainSubstring("invalid namespace selector"))
+		}).Should(Succeed())
+	})
+
+	It("should update status of reconciled namespaces on partial failure", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.ScopedQuotas = []necotiatorv1beta1.ScopedQuota{
+			{
+				// The BestEffort scope does not support limits.cpu, so the resource quota is rejected by the API server.
+				Name:   "best-effort",
+				Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("10m"),
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		err = k8sClient.Create(ctx, newNamespace(name, teamName))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var quota corev1.ResourceQuota
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+		quota.Status.Hard = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("0"),
+		}
+		quota.Status.Used = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("10m"),
+		}
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(tenantResourceQuota.Status.Used).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): MatchAllFields(Fields{
+					"Total": SemanticEqual(resource.MustParse("10m")),
+					"Namespaces": MatchAllKeys(Keys{
+						name: SemanticEqual(resource.MustParse("10m")),
+					}),
+				}),
+			}))
+			g.Expect(tenantResourceQuota.Status.ObservedGeneration).Should(BeZero())
+			condition := meta.FindStatusCondition(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionDegraded)
+			g.Expect(condition).ShouldNot(BeNil())
+			g.Expect(condition.Status).Should(Equal(metav1.ConditionTrue))
+			g.Expect(condition.Message).Should(ContainSubstring("failed to reconcile resource quota best-effort in namespace " + name))
+		}).Should(Succeed())
+	})
+
+	It("should create resource quota with configured name", func() {
+		name := newTestObjectName()
+		teamName := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		otherQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: name,
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"pods": resource.MustParse("5"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, otherQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.ResourceQuotaName = "tenant"
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: "tenant"}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(quota.Labels).Should(HaveKeyWithValue(constants.LabelTenant, tenantResourceQuotaName))
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("0")),
+			}))
+		}).Should(Succeed())
+
+		Consistently(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(quota.Labels).ShouldNot(HaveKey(constants.LabelTenant))
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("pods"): SemanticEqual(resource.MustParse("5")),
+			}))
+		}).Should(Succeed())
+	})
+
+	It("should create resource quota for each scoped quota", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.ScopedQuotas = []necotiatorv1beta1.ScopedQuota{
+			{
+				Name:   "best-effort",
+				Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+				Hard: corev1.ResourceList{
+					"pods": resource.MustParse("10"),
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var quota corev1.ResourceQuota
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: "best-effort"}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(quota.Labels).Should(HaveKeyWithValue(constants.LabelTenant, tenantResourceQuotaName))
+			g.Expect(quota.Spec.Scopes).Should(Equal([]corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort}))
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("pods"): SemanticEqual(resource.MustParse("0")),
+			}))
+		}).Should(Succeed())
+
+		quota.Status.Hard = corev1.ResourceList{
+			"pods": resource.MustParse("3"),
+		}
+		quota.Status.Used = corev1.ResourceList{
+			"pods": resource.MustParse("1"),
+		}
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(tenantResourceQuota.Status.ScopedQuotas).Should(HaveLen(1))
+			g.Expect(tenantResourceQuota.Status.ScopedQuotas[0]).Should(MatchAllFields(Fields{
+				"Name": Equal("best-effort"),
+				"Allocated": MatchAllKeys(Keys{
+					corev1.ResourceName("pods"): MatchAllFields(Fields{
+						"Total": SemanticEqual(resource.MustParse("3")),
+						"Namespaces": MatchAllKeys(Keys{
+							name: SemanticEqual(resource.MustParse("3")),
+						}),
+					}),
+				}),
+				"Used": MatchAllKeys(Keys{
+					corev1.ResourceName("pods"): MatchAllFields(Fields{
+						"Total": SemanticEqual(resource.MustParse("1")),
+						"Namespaces": MatchAllKeys(Keys{
+							name: SemanticEqual(resource.MustParse("1")),
+						}),
+					}),
+				}),
+			}))
+		}).Should(Succeed())
+	})
+
+	It("should replace scoped resource quota keeping pinned values when scopes change", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.ScopedQuotas = []necotiatorv1beta1.ScopedQuota{
+			{
+				Name:   "best-effort",
+				Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+				Hard: corev1.ResourceList{
+					"pods": resource.MustParse("10"),
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		err = k8sClient.Create(ctx, newNamespace(name, teamName))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var quota corev1.ResourceQuota
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: "best-effort"}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+
+		By("pinning the hard limit by another manager")
+		quota.Spec.Hard["pods"] = resource.MustParse("5")
+		err = k8sClient.Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+		oldUID := quota.UID
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			tenantResourceQuota.Spec.ScopedQuotas[0].Scopes = []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeNotBestEffort}
+			err = k8sClient.Update(ctx, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: "best-effort"}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(quota.UID).ShouldNot(Equal(oldUID))
+			g.Expect(quota.Spec.Scopes).Should(Equal([]corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeNotBestEffort}))
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("pods"): SemanticEqual(resource.MustParse("5")),
+			}))
+			pinned, err := pinnedHardByManager(tenantResourceQuota, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(pinned).Should(ConsistOf(MatchAllKeys(Keys{
+				corev1.ResourceName("pods"): SemanticEqual(resource.MustParse("5")),
+			})))
+		}).Should(Succeed())
+
+		var events corev1.EventList
+		err = k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(events.Items).ShouldNot(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+				"Name": Equal(tenantResourceQuotaName),
+			}),
+			"Reason": Equal("ResourceQuotaRecreated"),
+		})))
+	})
+
+	It("should apply namespace lease until it expires", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		name := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.NamespaceDefaults = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("20m"),
+		}
+		tenantResourceQuota.Spec.Leases = []necotiatorv1beta1.QuotaLease{
+			{
+				Name:      "campaign",
+				Namespace: name,
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("30m"),
+				},
+				ExpiresAt: metav1.NewTime(time.Now().Add(5 * time.Second)),
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = k8sClient.Create(ctx, newNamespace(name, teamName))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("50m")),
+			}))
+			g.Expect(quota.Annotations).Should(HaveKeyWithValue(constants.AnnotationAppliedLeases, "campaign"))
+
+			var tenantQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantQuota.Status.Leases).Should(ConsistOf(MatchFields(IgnoreExtras, Fields{
+				"Name":      Equal("campaign"),
+				"Namespace": Equal(name),
+			})))
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("20m")),
+			}))
+			g.Expect(quota.Annotations).ShouldNot(HaveKey(constants.AnnotationAppliedLeases))
+
+			var tenantQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantQuota.Status.Leases).Should(BeEmpty())
+		}).WithTimeout(10 * time.Second).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			var events corev1.EventList
+			err = k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(events.Items).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+					"Name": Equal(tenantResourceQuotaName),
+				}),
+				"Reason": Equal("LeaseExpired"),
+			})))
+		}).Should(Succeed())
+	})
+
+	It("should report hard limits of open schedule as effective", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, newTestObjectName())
+		tenantResourceQuota.Spec.Schedules = []necotiatorv1beta1.QuotaSchedule{
+			{
+				Name:  "always",
+				Start: "00:00",
+				End:   "00:00",
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("300m"),
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantResourceQuota.Status.Schedule).Should(Equal("always"))
+			g.Expect(tenantResourceQuota.Status.EffectiveHard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("300m")),
+			}))
+		}).Should(Succeed())
+	})
+
+	It("should reclaim allocation of idle namespace", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.NamespaceDefaults = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("50m"),
+		}
+		tenantResourceQuota.Spec.Reclaim = &necotiatorv1beta1.ReclaimPolicy{
+			IdlePeriod:      metav1.Duration{Duration: 2 * time.Second},
+			HeadroomPercent: 50,
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		err = k8sClient.Create(ctx, newNamespace(name, teamName))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var quota corev1.ResourceQuota
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+		quota.Status.Hard = quota.Spec.Hard
+		quota.Status.Used = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("10m"),
+		}
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantResourceQuota.Status.Idle).Should(ConsistOf(MatchFields(IgnoreExtras, Fields{
+				"Namespace": Equal(name),
+				"Resource":  Equal(corev1.ResourceName("limits.cpu")),
+			})))
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("15m")),
+			}))
+
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantResourceQuota.Status.Idle).Should(BeEmpty())
+			g.Expect(tenantResourceQuota.Status.Reclaimed).Should(ConsistOf(MatchFields(IgnoreExtras, Fields{
+				"Namespace": Equal(name),
+				"Resource":  Equal(corev1.ResourceName("limits.cpu")),
+				"Quantity":  SemanticEqual(resource.MustParse("35m")),
+				"Hard":      SemanticEqual(resource.MustParse("15m")),
+			})))
+		}).WithTimeout(10 * time.Second).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			var events corev1.EventList
+			err = k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(events.Items).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+					"Name": Equal(tenantResourceQuotaName),
+				}),
+				"Reason": Equal("QuotaReclaimed"),
+			})))
+		}).Should(Succeed())
+	})
+
+	It("should allocate resources dynamically by usage and weights", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		name := newTestObjectName()
+		name2 := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.AllocationPolicy = necotiatorv1beta1.AllocationDynamic
+		tenantResourceQuota.Spec.NamespaceWeights = map[string]int32{
+			name: 3,
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		for _, ns := range []string{name, name2} {
+			err = k8sClient.Create(ctx, newNamespace(ns, teamName))
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+
+		expectHard := func(namespace, cpu string) {
+			Eventually(func(g Gomega) {
+				var quota corev1.ResourceQuota
+				err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: constants.ResourceQuotaNameDefault}, &quota)
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+					corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse(cpu)),
+				}))
+			}).Should(Succeed())
+		}
+		expectHard(name, "75m")
+		expectHard(name2, "25m")
+
+		var quota corev1.ResourceQuota
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+		quota.Status.Used = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("20m"),
+		}
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		expectHard(name, "80m")
+		expectHard(name2, "20m")
+
+		By("pinning the hard limit of a namespace by another manager")
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name2, Name: constants.ResourceQuotaNameDefault}, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+		quota.Spec.Hard["limits.cpu"] = resource.MustParse("10m")
+		err = k8sClient.Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		expectHard(name, "90m")
+		expectHard(name2, "10m")
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantResourceQuota.Status.FieldOwners).Should(ConsistOf(
+				MatchAllFields(Fields{
+					"Namespace": Equal(name),
+					"Hard": MatchAllKeys(Keys{
+						corev1.ResourceName("limits.cpu"): Equal(constants.ControllerName),
+					}),
+				}),
+				MatchAllFields(Fields{
+					"Namespace": Equal(name2),
+					"Hard": MatchAllKeys(Keys{
+						corev1.ResourceName("limits.cpu"): Not(ContainSubstring(constants.ControllerName)),
+					}),
+				}),
+			))
+		}).Should(Succeed())
+	})
+
+	It("should honour namespace limits under the Dynamic allocation policy", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		name := newTestObjectName()
+		name2 := newTestObjectName()
+		name3 := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.AllocationPolicy = necotiatorv1beta1.AllocationDynamic
+		tenantResourceQuota.Spec.NamespaceWeights = map[string]int32{
+			name: 8,
+		}
+		tenantResourceQuota.Spec.NamespaceLimits = &necotiatorv1beta1.NamespaceLimits{
+			Min: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("25m"),
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		for _, ns := range []string{name, name2, name3} {
+			err = k8sClient.Create(ctx, newNamespace(ns, teamName))
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+
+		expectHard := func(namespace, cpu string) {
+			Eventually(func(g Gomega) {
+				var quota corev1.ResourceQuota
+				err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: constants.ResourceQuotaNameDefault}, &quota)
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+					corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse(cpu)),
+				}))
+			}).Should(Succeed())
+		}
+		expectHard(name, "45m")
+		expectHard(name2, "27m")
+		expectHard(name3, "27m")
+
+		By("sharing the allocation trimmed by the maximum among the other namespaces")
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			tenantResourceQuota.Spec.NamespaceLimits.Max = corev1.ResourceList{
+				"limits.cpu": resource.MustParse("40m"),
+			}
+			err = k8sClient.Update(ctx, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+
+		expectHard(name, "40m")
+		expectHard(name2, "30m")
+		expectHard(name3, "30m")
+	})
+
+	It("should recreate deleted resource quota with last known allocation", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.NamespaceDefaults = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("20m"),
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		err = k8sClient.Create(ctx, newNamespace(name, teamName))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var quota corev1.ResourceQuota
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+		quota.Status.Hard = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("60m"),
+		}
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantResourceQuota.Status.Allocated["limits.cpu"].Namespaces).Should(MatchAllKeys(Keys{
+				name: SemanticEqual(resource.MustParse("60m")),
+			}))
+		}).Should(Succeed())
+
+		err = k8sClient.Delete(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var recreated corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &recreated)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(recreated.UID).ShouldNot(Equal(quota.UID))
+			g.Expect(recreated.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("60m")),
+			}))
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			var events corev1.EventList
+			err = k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(events.Items).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+					"Name": Equal(tenantResourceQuotaName),
+				}),
+				"Reason": Equal("ResourceQuotaRecreated"),
+			})))
 		}).Should(Succeed())
 	})
 
-	It("should update TenantResourceQuota status", func() {
+	It("should backfill resource newly added to hard limits", func() {
 		tenantResourceQuotaName := newTestObjectName()
 		teamName := newTestObjectName()
 		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
@@ -139,72 +926,417 @@ var _ = Describe("Test TenantResourceQuotaController", func() {
 		Expect(err).ShouldNot(HaveOccurred())
 
 		name := newTestObjectName()
-		namespace := newNamespace(name, teamName)
-		err = k8sClient.Create(ctx, namespace)
+		err = k8sClient.Create(ctx, newNamespace(name, teamName))
 		Expect(err).ShouldNot(HaveOccurred())
 
-		name2 := newTestObjectName()
-		namespace2 := newNamespace(name2, teamName)
-		err = k8sClient.Create(ctx, namespace2)
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		tenantResourceQuota.Spec.Hard["requests.nvidia.com/gpu"] = resource.MustParse("4")
+		err = k8sClient.Update(ctx, tenantResourceQuota)
 		Expect(err).ShouldNot(HaveOccurred())
 
 		Eventually(func(g Gomega) {
 			var quota corev1.ResourceQuota
 			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
 			g.Expect(err).ShouldNot(HaveOccurred())
-			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name2, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(quota.Spec.Hard).Should(HaveKeyWithValue(corev1.ResourceName("requests.nvidia.com/gpu"), SemanticEqual(resource.MustParse("0"))))
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			var events corev1.EventList
+			err = k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(events.Items).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+					"Name": Equal(tenantResourceQuotaName),
+				}),
+				"Reason":  Equal("ResourceBackfilled"),
+				"Message": ContainSubstring("requests.nvidia.com/gpu=0"),
+			})))
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantResourceQuota.Status.MissingResources).Should(BeEmpty())
+		}).Should(Succeed())
+	})
+
+	It("should expand hard patterns into resource quotas and total matching resources", func() {
+		gold := newTestObjectName()
+		silver := newTestObjectName()
+		for _, storageClassName := range []string{gold, silver} {
+			err := k8sClient.Create(ctx, &storagev1.StorageClass{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: storageClassName,
+				},
+				Provisioner: "kubernetes.io/no-provisioner",
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		goldStorage := corev1.ResourceName(gold + ".storageclass.storage.k8s.io/requests.storage")
+		silverStorage := corev1.ResourceName(silver + ".storageclass.storage.k8s.io/requests.storage")
+		storagePattern := corev1.ResourceName("*.storageclass.storage.k8s.io/requests.storage")
+		countPattern := corev1.ResourceName("count/*")
+
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.HardPatterns = corev1.ResourceList{
+			storagePattern: resource.MustParse("10Gi"),
+			countPattern:   resource.MustParse("15"),
+		}
+		tenantResourceQuota.Spec.NamespaceDefaults = corev1.ResourceList{
+			"count/pods": resource.MustParse("10"),
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		err = k8sClient.Create(ctx, newNamespace(name, teamName))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
 			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(quota.Spec.Hard).Should(HaveKeyWithValue(corev1.ResourceName("limits.cpu"), SemanticEqual(resource.MustParse("0"))))
+			g.Expect(quota.Spec.Hard).Should(HaveKeyWithValue(goldStorage, SemanticEqual(resource.MustParse("0"))))
+			g.Expect(quota.Spec.Hard).Should(HaveKeyWithValue(silverStorage, SemanticEqual(resource.MustParse("0"))))
+			g.Expect(quota.Spec.Hard).Should(HaveKeyWithValue(corev1.ResourceName("count/configmaps"), SemanticEqual(resource.MustParse("0"))))
+			g.Expect(quota.Spec.Hard).Should(HaveKeyWithValue(corev1.ResourceName("count/pods"), SemanticEqual(resource.MustParse("10"))))
+			g.Expect(quota.Spec.Hard).ShouldNot(HaveKey(storagePattern))
+			g.Expect(quota.Spec.Hard).ShouldNot(HaveKey(countPattern))
 		}).Should(Succeed())
 
 		var quota corev1.ResourceQuota
 		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
 		Expect(err).ShouldNot(HaveOccurred())
 		quota.Status.Hard = corev1.ResourceList{
-			"limits.cpu": resource.MustParse("0"),
+			"limits.cpu":  resource.MustParse("0"),
+			goldStorage:   resource.MustParse("3Gi"),
+			silverStorage: resource.MustParse("2Gi"),
+			"count/pods":  resource.MustParse("4"),
 		}
-		quota.Status.Used = corev1.ResourceList{
-			"limits.cpu": resource.MustParse("1"),
+		err = k8sClient.Status().Update(ctx, &quota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantResourceQuota.Status.Allocated).Should(HaveKeyWithValue(storagePattern, MatchFields(IgnoreExtras, Fields{
+				"Total": SemanticEqual(resource.MustParse("5Gi")),
+			})))
+			g.Expect(tenantResourceQuota.Status.Allocated).Should(HaveKeyWithValue(countPattern, MatchFields(IgnoreExtras, Fields{
+				"Total":      SemanticEqual(resource.MustParse("4")),
+				"Namespaces": HaveKeyWithValue(name, SemanticEqual(resource.MustParse("4"))),
+			})))
+		}).Should(Succeed())
+	})
+
+	It("should grant namespace defaults to newly selected namespace", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.NamespaceDefaults = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("30m"),
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("30m")),
+			}))
+		}).Should(Succeed())
+	})
+
+	It("should not grant namespace defaults exceeding tenant hard limits", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.NamespaceDefaults = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("200m"),
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("0")),
+			}))
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			var events corev1.EventList
+			err = k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(events.Items).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+					"Name": Equal(tenantResourceQuotaName),
+				}),
+				"Reason": Equal("DefaultNotGranted"),
+			})))
+		}).Should(Succeed())
+	})
+
+	It("should not grant namespace minimum without namespace defaults", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.NamespaceLimits = &necotiatorv1beta1.NamespaceLimits{
+			Min: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("10m"),
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("0")),
+			}))
+		}).Should(Succeed())
+	})
+
+	It("should report namespaces out of namespace limits", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		teamName := newTestObjectName()
+		tenantResourceQuota := newTenantResourceQuota(tenantResourceQuotaName, teamName)
+		tenantResourceQuota.Spec.NamespaceLimits = &necotiatorv1beta1.NamespaceLimits{
+			Max: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("30m"),
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var quota corev1.ResourceQuota
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+
+		quota.Status.Hard = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("50m"),
 		}
 		err = k8sClient.Status().Update(ctx, &quota)
 		Expect(err).ShouldNot(HaveOccurred())
 
-		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name2, Name: constants.ResourceQuotaNameDefault}, &quota)
+		Eventually(func(g Gomega) {
+			var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(tenantResourceQuota.Status.NamespaceLimitViolations).Should(ConsistOf(MatchAllFields(Fields{
+				"Namespace": Equal(name),
+				"Resource":  Equal(corev1.ResourceName("limits.cpu")),
+				"Type":      Equal(necotiatorv1beta1.NamespaceLimitMax),
+				"Allocated": SemanticEqual(resource.MustParse("50m")),
+				"Limit":     SemanticEqual(resource.MustParse("30m")),
+			})))
+		}).Should(Succeed())
+	})
+
+	It("should aggregate allocations of child tenants into parent status", func() {
+		parentName := newTestObjectName()
+		parent := newTenantResourceQuota(parentName, newTestObjectName())
+		err := k8sClient.Create(ctx, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		childName := newTestObjectName()
+		teamName := newTestObjectName()
+		child := newTenantResourceQuota(childName, teamName)
+		child.Spec.Parent = parentName
+		err = k8sClient.Create(ctx, child)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
 		Expect(err).ShouldNot(HaveOccurred())
+
+		var quota corev1.ResourceQuota
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+		}).Should(Succeed())
+
 		quota.Status.Hard = corev1.ResourceList{
-			"limits.cpu": resource.MustParse("0"),
+			"limits.cpu": resource.MustParse("50m"),
 		}
 		quota.Status.Used = corev1.ResourceList{
-			"limits.cpu": resource.MustParse("100m"),
+			"limits.cpu": resource.MustParse("10m"),
 		}
 		err = k8sClient.Status().Update(ctx, &quota)
 		Expect(err).ShouldNot(HaveOccurred())
 
 		Eventually(func(g Gomega) {
 			var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
-			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &tenantResourceQuota)
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: parentName}, &tenantResourceQuota)
 			g.Expect(err).ShouldNot(HaveOccurred())
 
 			g.Expect(tenantResourceQuota.Status.Allocated).Should(MatchAllKeys(Keys{
 				corev1.ResourceName("limits.cpu"): MatchAllFields(Fields{
-					"Total": SemanticEqual(resource.MustParse("0")),
+					"Total": SemanticEqual(resource.MustParse("50m")),
 					"Namespaces": MatchAllKeys(Keys{
-						name:  SemanticEqual(resource.MustParse("0")),
-						name2: SemanticEqual(resource.MustParse("0")),
+						name: SemanticEqual(resource.MustParse("50m")),
 					}),
 				}),
 			}))
 			g.Expect(tenantResourceQuota.Status.Used).Should(MatchAllKeys(Keys{
 				corev1.ResourceName("limits.cpu"): MatchAllFields(Fields{
-					"Total": SemanticEqual(resource.MustParse("1100m")),
+					"Total": SemanticEqual(resource.MustParse("10m")),
 					"Namespaces": MatchAllKeys(Keys{
-						name:  SemanticEqual(resource.MustParse("1")),
-						name2: SemanticEqual(resource.MustParse("100m")),
+						name: SemanticEqual(resource.MustParse("10m")),
 					}),
 				}),
 			}))
 		}).Should(Succeed())
 	})
 
+	It("should report namespaces selected by multiple tenants", func() {
+		teamName := newTestObjectName()
+		lowName := newTestObjectName()
+		low := newTenantResourceQuota(lowName, teamName)
+		err := k8sClient.Create(ctx, low)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		highName := newTestObjectName()
+		high := newTenantResourceQuota(highName, teamName)
+		high.Spec.Priority = 10
+		err = k8sClient.Create(ctx, high)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		namespace := newNamespace(name, teamName)
+		err = k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			g.Expect(quota.Labels).Should(HaveKeyWithValue(constants.LabelTenant, highName))
+		}).Should(Succeed())
+
+		for _, tenant := range []string{lowName, highName} {
+			other := highName
+			if tenant == highName {
+				other = lowName
+			}
+			Eventually(func(g Gomega) {
+				var tenantResourceQuota necotiatorv1beta1.TenantResourceQuota
+				err = k8sClient.Get(ctx, client.ObjectKey{Name: tenant}, &tenantResourceQuota)
+				g.Expect(err).ShouldNot(HaveOccurred())
+
+				g.Expect(tenantResourceQuota.Status.Conflicts).Should(ConsistOf(necotiatorv1beta1.NamespaceConflict{
+					Namespace: name,
+					Tenant:    other,
+					Owner:     highName,
+				}))
+				condition := meta.FindStatusCondition(tenantResourceQuota.Status.Conditions, necotiatorv1beta1.ConditionNamespaceConflict)
+				g.Expect(condition).ShouldNot(BeNil())
+				g.Expect(condition.Status).Should(Equal(metav1.ConditionTrue))
+				g.Expect(condition.Message).Should(ContainSubstring(name))
+			}).Should(Succeed())
+		}
+	})
+
+	It("should keep hard limits within remaining resources when taking over namespace", func() {
+		teamName := newTestObjectName()
+		lowName := newTestObjectName()
+		low := newTenantResourceQuota(lowName, teamName)
+		low.Spec.NamespaceDefaults = corev1.ResourceList{
+			"limits.cpu": resource.MustParse("60m"),
+		}
+		err := k8sClient.Create(ctx, low)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		name := newTestObjectName()
+		err = k8sClient.Create(ctx, newNamespace(name, teamName))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(quota.Labels).Should(HaveKeyWithValue(constants.LabelTenant, lowName))
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("60m")),
+			}))
+		}).Should(Succeed())
+
+		highName := newTestObjectName()
+		high := newTenantResourceQuota(highName, teamName)
+		high.Spec.Priority = 10
+		high.Spec.Hard["limits.cpu"] = resource.MustParse("50m")
+		err = k8sClient.Create(ctx, high)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			var quota corev1.ResourceQuota
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: name, Name: constants.ResourceQuotaNameDefault}, &quota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(quota.Labels).Should(HaveKeyWithValue(constants.LabelTenant, highName))
+			g.Expect(quota.Spec.Hard).Should(MatchAllKeys(Keys{
+				corev1.ResourceName("limits.cpu"): SemanticEqual(resource.MustParse("50m")),
+			}))
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			var events corev1.EventList
+			err = k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(events.Items).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+					"Name": Equal(highName),
+				}),
+				"Reason":  Equal("NamespaceTakenOver"),
+				"Message": ContainSubstring(lowName),
+			})))
+		}).Should(Succeed())
+	})
+
 	It("should create namespace before tenant resource", func() {
 		namespaceName := newTestObjectName()
 		teamName := newTestObjectName()
@@ -389,6 +1521,11 @@ var _ = Describe("Test TenantResourceQuotaController", func() {
 			g.Expect(err).ShouldNot(HaveOccurred())
 
 			g.Expect(quota.Labels).Should(BeEmpty())
+
+			var ns corev1.Namespace
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: namespaceName}, &ns)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(ns.Labels).ShouldNot(HaveKey(constants.LabelTenant))
 		}).Should(Succeed())
 	})
 
@@ -0,0 +1,50 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var dryRunViolationsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "necotiator_tenantresourcequota_dryrun_violations_total",
+		Help: "Number of changes of resource quotas exceeding the hard limits allowed by the DryRun enforcement mode",
+	},
+	[]string{"tenantresourcequota", "resource"},
+)
+
+var dryRunUsageViolationsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "necotiator_tenantresourcequota_dryrun_usage_violations_total",
+		Help: "Number of pods and persistent volume claims exceeding the hard limits allowed by the DryRun enforcement mode",
+	},
+	[]string{"tenantresourcequota", "resource"},
+)
+
+var allocationDrift = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "necotiator_tenantresourcequota_allocation_drift",
+		Help: "Difference of the allocation computed from resource quotas by the webhook from the status of the tenant resource quota",
+	},
+	[]string{"tenantresourcequota", "resource"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(dryRunViolationsTotal, dryRunUsageViolationsTotal, allocationDrift)
+}
@@ -19,13 +19,22 @@ package hooks
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -34,26 +43,91 @@ import (
 
 	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
 	"github.com/cybozu-go/necotiator/pkg/constants"
+	"github.com/cybozu-go/necotiator/pkg/fieldowner"
+	"github.com/cybozu-go/necotiator/pkg/resourcename"
 )
 
 // log is for logging in this package.
 var resourcequotalog = logf.Log.WithName("resourcequota-resource")
 
+// reservationBackoff is the backoff to retry reservations conflicting with concurrent admissions.
+var reservationBackoff = wait.Backoff{
+	Steps:    20,
+	Duration: 10 * time.Millisecond,
+	Factor:   1.2,
+	Jitter:   1.0,
+}
+
 type resourceQuotaValidator struct {
 	client         client.Client
+	apiReader      client.Reader
+	recorder       record.EventRecorder
 	namespace      string
 	serviceAccount string
+	deleterGroups  []string
+	bypass         BypassIdentities
+	liveAllocation bool
+
+	// reportedDrift is the last drift message reported as an event for each tenant.
+	reportedDrift   map[string]string
+	reportedDriftMu sync.Mutex
+}
+
+// BypassIdentities is the set of identities exempted from the label immutability and the tenant limits of resource quotas.
+type BypassIdentities struct {
+	// Users is the list of user names.
+	Users []string
+	// Groups is the list of group names.
+	Groups []string
+	// ServiceAccounts is the list of service accounts in the form of namespace:name.
+	ServiceAccounts []string
+}
+
+// matches returns true if the user is one of the identities.
+func (b *BypassIdentities) matches(user authenticationv1.UserInfo) bool {
+	for _, name := range b.Users {
+		if user.Username == name {
+			return true
+		}
+	}
+	for _, sa := range b.ServiceAccounts {
+		if user.Username == "system:serviceaccount:"+sa {
+			return true
+		}
+	}
+	for _, group := range user.Groups {
+		for _, name := range b.Groups {
+			if group == name {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func SetupResourceQuotaWebhookWithManager(mgr ctrl.Manager, ns, sa string) error {
-	return ctrl.NewWebhookManagedBy(mgr).
-		For(&corev1.ResourceQuota{}).
-		WithValidator(&resourceQuotaValidator{mgr.GetClient(), ns, sa}).
-		Complete()
+// SetupResourceQuotaWebhookWithManager registers the webhook for resource quotas.
+// Users in deleterGroups are allowed to delete resource quotas managed by tenants in addition to the controller,
+// and the bypass identities are exempted from the label immutability and the tenant limits.
+// If liveAllocation is true, the allocation of tenants is computed from the cached resource quotas instead of the status.
+// The handler is registered without the webhook builder so that the validator can return admission warnings.
+func SetupResourceQuotaWebhookWithManager(mgr ctrl.Manager, ns, sa string, deleterGroups []string, bypass BypassIdentities, liveAllocation bool) error {
+	hook := admission.WithCustomValidator(&corev1.ResourceQuota{}, &resourceQuotaValidator{
+		client:         mgr.GetClient(),
+		apiReader:      mgr.GetAPIReader(),
+		recorder:       mgr.GetEventRecorderFor(constants.EventRecorderName),
+		namespace:      ns,
+		serviceAccount: sa,
+		deleterGroups:  deleterGroups,
+		bypass:         bypass,
+		liveAllocation: liveAllocation,
+	})
+	hook.Handler = &warningHandler{Handler: hook.Handler}
+	mgr.GetWebhookServer().Register("/validate--v1-resourcequota", hook)
+	return nil
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-//+kubebuilder:webhook:path=/validate--v1-resourcequota,mutating=false,failurePolicy=fail,sideEffects=None,groups=core,resources=resourcequotas,verbs=create;update,versions=v1,name=vresourcequota.kb.io,admissionReviewVersions=v1
+// The webhook records reservations in the status of tenants except for requests in dry run.
+//+kubebuilder:webhook:path=/validate--v1-resourcequota,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=core,resources=resourcequotas,verbs=create;update;delete,versions=v1,name=vresourcequota.kb.io,admissionReviewVersions=v1
 
 var _ admission.CustomValidator = &resourceQuotaValidator{}
 
@@ -62,7 +136,7 @@ func (r *resourceQuotaValidator) ValidateCreate(ctx context.Context, obj runtime
 	resourcequotalog.Info("validate create")
 
 	if rq, ok := obj.(*corev1.ResourceQuota); ok {
-		return r.validate(ctx, rq)
+		return r.validate(ctx, nil, rq)
 	}
 	return nil
 }
@@ -84,20 +158,76 @@ func (r *resourceQuotaValidator) ValidateUpdate(ctx context.Context, oldObj, new
 		return err
 	}
 
-	return r.validate(ctx, rq)
+	return r.validate(ctx, old, rq)
 }
 
-func (r *resourceQuotaValidator) validateLabelChange(ctx context.Context, oldObj, newObj *corev1.ResourceQuota) error {
+// requestedByController returns true if the request is sent by the service account of the controller.
+func (r *resourceQuotaValidator) requestedByController(ctx context.Context) (bool, error) {
+	request, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	return request.UserInfo.Username == fmt.Sprintf("system:serviceaccount:%s:%s", r.namespace, r.serviceAccount), nil
+}
+
+// bypassed returns true if the request is sent by one of the bypass identities, and records the bypass unless the request is in dry run.
+// rq is the resource quota in the request, and tenantName is the tenant whose check is bypassed.
+func (r *resourceQuotaValidator) bypassed(ctx context.Context, rq *corev1.ResourceQuota, tenantName, check string) (bool, error) {
 	request, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !r.bypass.matches(request.UserInfo) {
+		return false, nil
+	}
+	if request.DryRun != nil && *request.DryRun {
+		return true, nil
+	}
+
+	log.FromContext(ctx).Info("Bypassed validation of resource quota",
+		"check", check,
+		"user", request.UserInfo.Username,
+		"groups", request.UserInfo.Groups,
+		"namespace", rq.Namespace,
+		"name", rq.Name,
+		"tenant", tenantName,
+	)
+	var quota necotiatorv1beta1.TenantResourceQuota
+	err = r.client.Get(ctx, client.ObjectKey{Name: tenantName}, &quota)
+	if client.IgnoreNotFound(err) != nil {
+		return false, err
+	}
+	if err == nil {
+		r.recorder.Event(&quota, corev1.EventTypeNormal, "ValidationBypassed", fmt.Sprintf(
+			"User %s bypassed %s of resource quota %s/%s", request.UserInfo.Username, check, rq.Namespace, rq.Name,
+		))
+	}
+	return true, nil
+}
+
+func (r *resourceQuotaValidator) validateLabelChange(ctx context.Context, oldObj, newObj *corev1.ResourceQuota) error {
+	byController, err := r.requestedByController(ctx)
 	if err != nil {
 		return err
 	}
-	if request.UserInfo.Username == fmt.Sprintf("system:serviceaccount:%s:%s", r.namespace, r.serviceAccount) {
+	if byController {
 		return nil
 	}
 
 	if oldObj.Labels[constants.LabelTenant] != newObj.Labels[constants.LabelTenant] {
-		err := apierrors.NewInvalid(
+		tenantName := oldObj.Labels[constants.LabelTenant]
+		if tenantName == "" {
+			tenantName = newObj.Labels[constants.LabelTenant]
+		}
+		bypassed, err := r.bypassed(ctx, newObj, tenantName, "label immutability")
+		if err != nil {
+			return err
+		}
+		if bypassed {
+			return nil
+		}
+
+		err = apierrors.NewInvalid(
 			schema.GroupKind{Group: corev1.GroupName, Kind: "ResourceQuota"},
 			newObj.Name,
 			field.ErrorList{field.Forbidden(
@@ -110,7 +240,8 @@ func (r *resourceQuotaValidator) validateLabelChange(ctx context.Context, oldObj
 	return nil
 }
 
-func (v *resourceQuotaValidator) validate(ctx context.Context, rq *corev1.ResourceQuota) error {
+// validate checks the resource quota against the tenant resource quota. old is nil on creation.
+func (v *resourceQuotaValidator) validate(ctx context.Context, old, rq *corev1.ResourceQuota) error {
 	logger := log.FromContext(ctx)
 
 	tenantName, ok := rq.Labels[constants.LabelTenant]
@@ -123,13 +254,501 @@ func (v *resourceQuotaValidator) validate(ctx context.Context, rq *corev1.Resour
 	if err != nil {
 		return err
 	}
+	err = v.useLiveAllocation(ctx, &quota, true)
+	if err != nil {
+		return err
+	}
+
+	hard, allocated, ok := quota.Limit(rq.Name, time.Now())
+	if !ok {
+		return nil
+	}
 
-	allocated := quota.Status.Allocated
+	// The controller writes the allocations it computes by itself, and checks the transfers against
+	// the latest status by itself, so its writes are not limited by the possibly stale allocation in the status.
+	byController, err := v.requestedByController(ctx)
+	if err != nil {
+		return err
+	}
 
+	var limitErrs field.ErrorList
+	var limited []limitedQuota
+	if !byController {
+		errs, err := v.enforceTenantLimit(ctx, rq, &quota, hard, allocated)
+		if err != nil {
+			return err
+		}
+		limitErrs = append(limitErrs, errs...)
+		limited = append(limited, limitedQuota{tenant: quota.Name, resourceQuota: rq.Name})
+	}
 	var errs field.ErrorList
-	for resourceName, requested := range rq.Spec.Hard {
+	if rq.Name == quota.GetResourceQuotaName() {
+		errs = append(errs, validateNamespaceLimits(old, rq, &quota)...)
+		errs = append(errs, validateUsageGuard(rq, &quota)...)
+		fieldErrs, err := validateFieldManagers(old, rq, &quota)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, fieldErrs...)
+	}
+	errs = append(errs, validateResourceNames(rq, tenantName, hard)...)
+	for resourceName := range hard {
+		if resourcename.IsPattern(resourceName) {
+			continue
+		}
+		if _, ok := resourcename.Lookup(rq.Spec.Hard, resourceName); !ok {
+			if inMissingResourceGracePeriod(old, rq, &quota, resourceName, time.Now()) {
+				addWarning(ctx, fmt.Sprintf(
+					"missing %s required by tenant resource quota: %s, it will be backfilled by the controller",
+					resourceName, tenantName,
+				))
+				continue
+			}
+			errs = append(errs, field.Required(
+				field.NewPath("spec", "hard", string(resourceName)),
+				fmt.Sprintf(
+					"required %s by tenant resource quota: %s",
+					resourceName, tenantName,
+				),
+			))
+		}
+	}
+
+	tenantQuota := quota
+	visited := map[string]bool{tenantName: true}
+	for parentName := quota.Spec.Parent; parentName != ""; parentName = quota.Spec.Parent {
+		if visited[parentName] {
+			return fmt.Errorf("circular parent reference of tenant resource quota: %s", parentName)
+		}
+		visited[parentName] = true
+
+		quota = necotiatorv1beta1.TenantResourceQuota{}
+		err := v.client.Get(ctx, client.ObjectKey{Name: parentName}, &quota)
+		if err != nil {
+			return err
+		}
+		err = v.useLiveAllocation(ctx, &quota, true)
+		if err != nil {
+			return err
+		}
+		name := tenantQuota.AncestorResourceQuotaName(&quota, rq.Name)
+		if hard, allocated, ok := quota.Limit(name, time.Now()); ok && !byController {
+			errs, err := v.enforceTenantLimit(ctx, rq, &quota, hard, allocated)
+			if err != nil {
+				return err
+			}
+			limitErrs = append(limitErrs, errs...)
+			limited = append(limited, limitedQuota{tenant: quota.Name, resourceQuota: name})
+		}
+	}
+
+	bypassed := false
+	if len(limitErrs) > 0 {
+		bypassed, err = v.bypassed(ctx, rq, tenantName, "tenant limits")
+		if err != nil {
+			return err
+		}
+		if !bypassed {
+			errs = append(limitErrs, errs...)
+		}
+	}
+
+	// The allocation in the cached status does not include raises admitted concurrently,
+	// so the raise is reserved in each tenant with the latest status before it is admitted.
+	if len(errs) == 0 && !bypassed {
+		request, err := admission.RequestFromContext(ctx)
+		if err != nil {
+			return err
+		}
+		if request.DryRun == nil || !*request.DryRun {
+			for _, target := range limited {
+				reserveErrs, err := v.reserve(ctx, rq, target.tenant, target.resourceQuota)
+				if err != nil {
+					return err
+				}
+				errs = append(errs, reserveErrs...)
+				if len(errs) > 0 {
+					break
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		err := apierrors.NewInvalid(schema.GroupKind{Group: corev1.GroupName, Kind: "ResourceQuota"}, rq.Name, errs)
+		logger.Error(err, "validation error")
+		return err
+	}
+
+	return nil
+}
+
+// validateResourceNames checks that the resource quota uses the same names as the hard limits of the tenant
+// for the resources treated as equivalent by resource quotas, such as cpu and requests.cpu.
+func validateResourceNames(rq *corev1.ResourceQuota, tenantName string, hard corev1.ResourceList) field.ErrorList {
+	var errs field.ErrorList
+	for resourceName := range rq.Spec.Hard {
+		if _, ok := hard[resourceName]; ok {
+			continue
+		}
+		if equivalent, ok := resourcename.Lookup(hard, resourceName); ok {
+			errs = append(errs, field.Forbidden(
+				field.NewPath("spec", "hard", string(resourceName)),
+				fmt.Sprintf(
+					"equivalent to %s limited by tenant resource quota: %s, use %s instead",
+					equivalent, tenantName, equivalent,
+				),
+			))
+		}
+	}
+	return errs
+}
+
+// inMissingResourceGracePeriod returns true if the resource quota can lack the resource in the grace period of the tenant.
+// The grace period of each namespace starts when the controller finds the resource missing, and removing the resource is not allowed.
+func inMissingResourceGracePeriod(old, rq *corev1.ResourceQuota, quota *necotiatorv1beta1.TenantResourceQuota, resourceName corev1.ResourceName, now time.Time) bool {
+	gracePeriod := quota.Spec.MissingResourceGracePeriod
+	if gracePeriod == nil {
+		return false
+	}
+	if old != nil {
+		if _, ok := old.Spec.Hard[resourceName]; ok {
+			return false
+		}
+	}
+	since, ok := quota.Status.MissingSince(rq.Name, resourceName, rq.Namespace)
+	if !ok {
+		// The controller has not observed the resource missing yet, so the grace period starts now.
+		since = metav1.NewTime(now)
+	}
+	return now.Before(since.Add(gracePeriod.Duration))
+}
+
+// useLiveAllocation replaces the allocation in the status of the tenant with the one computed from the cached resource quotas
+// if the live allocation is enabled. The drift of the status from the computed allocation is reported if report is true.
+func (v *resourceQuotaValidator) useLiveAllocation(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota, report bool) error {
+	if !v.liveAllocation {
+		return nil
+	}
+
+	allocated, observed, scopedAllocated, err := v.computeAllocation(ctx, quota)
+	if err != nil {
+		return err
+	}
+	if report {
+		v.reportDrift(ctx, quota, observed)
+	}
+
+	quota.Status.Allocated = allocated
+	for name, scoped := range scopedAllocated {
+		found := false
+		for i := range quota.Status.ScopedQuotas {
+			if quota.Status.ScopedQuotas[i].Name == name {
+				quota.Status.ScopedQuotas[i].Allocated = scoped
+				found = true
+			}
+		}
+		if !found {
+			quota.Status.ScopedQuotas = append(quota.Status.ScopedQuotas, necotiatorv1beta1.ScopedQuotaStatus{
+				Name:      name,
+				Allocated: scoped,
+			})
+		}
+	}
+	return nil
+}
+
+// computeAllocation sums up the hard limits of the cached resource quotas labeled with the tenant and its descendants
+// in the namespaces selected by them.
+// It returns the allocation of the managed resource quotas, the same allocation observed in the status of the resource quotas
+// to be compared with the status of the tenant, and the allocation of each scoped quota.
+func (v *resourceQuotaValidator) computeAllocation(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota) (map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage, map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage, map[string]map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage, error) {
+	var quotas necotiatorv1beta1.TenantResourceQuotaList
+	err := v.client.List(ctx, &quotas)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tenants := map[string]*necotiatorv1beta1.TenantResourceQuota{quota.Name: quota}
+	for added := true; added; {
+		added = false
+		for i := range quotas.Items {
+			tenant := &quotas.Items[i]
+			if _, ok := tenants[tenant.Name]; ok || tenant.Spec.Parent == "" {
+				continue
+			}
+			if _, ok := tenants[tenant.Spec.Parent]; ok {
+				tenants[tenant.Name] = tenant
+				added = true
+			}
+		}
+	}
+
+	allocated := make(map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage)
+	observed := make(map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage)
+	scopedAllocated := make(map[string]map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage)
+	for _, scopedQuota := range quota.Spec.ScopedQuotas {
+		scopedAllocated[scopedQuota.Name] = make(map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage)
+	}
+	scopedHard := make(map[string]corev1.ResourceList)
+	for _, scopedQuota := range quota.Spec.ScopedQuotas {
+		scopedHard[scopedQuota.Name] = scopedQuota.Hard
+	}
+	for name, tenant := range tenants {
+		selected, err := v.selectedNamespaces(ctx, tenant)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		var rqList corev1.ResourceQuotaList
+		err = v.client.List(ctx, &rqList, client.MatchingLabels{constants.LabelTenant: name})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, rq := range rqList.Items {
+			if !selected[rq.Namespace] {
+				continue
+			}
+			if rq.Name == tenant.GetResourceQuotaName() {
+				addAllocation(allocated, resourcename.WithTotals(resourcename.Translate(rq.Spec.Hard, quota.Spec.Hard), quota.Spec.HardPatterns), rq.Namespace)
+				addAllocation(observed, resourcename.WithTotals(resourcename.Translate(rq.Status.Hard, quota.Spec.Hard), quota.Spec.HardPatterns), rq.Namespace)
+			} else if scoped, ok := scopedAllocated[rq.Name]; ok {
+				addAllocation(scoped, resourcename.Translate(rq.Spec.Hard, scopedHard[rq.Name]), rq.Namespace)
+			}
+		}
+	}
+	return allocated, observed, scopedAllocated, nil
+}
+
+// selectedNamespaces returns the set of the names of the cached namespaces selected by the tenant.
+func (v *resourceQuotaValidator) selectedNamespaces(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota) (map[string]bool, error) {
+	selector, err := metav1.LabelSelectorAsSelector(quota.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, nil
+	}
+	var namespaces corev1.NamespaceList
+	err = v.client.List(ctx, &namespaces, &client.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]bool, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		selected[ns.Name] = true
+	}
+	return selected, nil
+}
+
+// addAllocation adds the hard limits of the resource quota in the namespace to the allocation.
+func addAllocation(allocated map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage, hard corev1.ResourceList, namespaceName string) {
+	for resourceName, quantity := range hard {
+		usage := allocated[resourceName]
+		if usage.Namespaces == nil {
+			usage.Namespaces = make(map[string]resource.Quantity)
+		}
+		usage.Total.Add(quantity)
+		usage.Namespaces[namespaceName] = quantity
+		allocated[resourceName] = usage
+	}
+}
+
+// reportDrift reports the difference of the total allocation in the status of the tenant from the computed one
+// as the metrics and an event. The event is recorded only when the drift changes, since every admission reports it.
+func (v *resourceQuotaValidator) reportDrift(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota, allocated map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage) {
+	resourceNames := make(map[corev1.ResourceName]struct{})
+	for resourceName := range allocated {
+		resourceNames[resourceName] = struct{}{}
+	}
+	for resourceName := range quota.Status.Allocated {
+		resourceNames[resourceName] = struct{}{}
+	}
+
+	var drifted []string
+	for resourceName := range resourceNames {
+		computed := allocated[resourceName].Total
+		observed := quota.Status.Allocated[resourceName].Total
+		drift := computed.DeepCopy()
+		drift.Sub(observed)
+		allocationDrift.WithLabelValues(quota.Name, string(resourceName)).Set(float64(drift.MilliValue()) / 1000)
+		if !drift.IsZero() {
+			drifted = append(drifted, fmt.Sprintf("%s (computed: %s, status: %s)", resourceName, computed.String(), observed.String()))
+		}
+	}
+
+	var message string
+	if len(drifted) > 0 {
+		sort.Strings(drifted)
+		message = "Allocation in the status differs from the resource quotas: " + strings.Join(drifted, ", ")
+	}
+
+	v.reportedDriftMu.Lock()
+	defer v.reportedDriftMu.Unlock()
+	if v.reportedDrift[quota.Name] == message {
+		return
+	}
+	if message == "" {
+		delete(v.reportedDrift, quota.Name)
+		return
+	}
+	if v.reportedDrift == nil {
+		v.reportedDrift = make(map[string]string)
+	}
+	v.reportedDrift[quota.Name] = message
+	log.FromContext(ctx).Info("Detected allocation drift", "tenant", quota.Name, "message", message)
+	v.recorder.Event(quota, corev1.EventTypeWarning, "AllocationDrift", message)
+}
+
+// limitedQuota is a tenant limiting the resource quota in the request,
+// and the name of the resource quotas of the tenant whose limits apply to it.
+type limitedQuota struct {
+	tenant        string
+	resourceQuota string
+}
+
+// reserve checks the resource quota against the hard limits in the latest status of the tenant,
+// and records the raised hard limits in the reservations of the tenant.
+// name is the name of the resource quotas of the tenant whose limits apply to the resource quota,
+// which differs from the name of the resource quota if the tenant is an ancestor.
+// The status is updated with optimistic concurrency, so concurrent raises are checked one after another.
+func (v *resourceQuotaValidator) reserve(ctx context.Context, rq *corev1.ResourceQuota, tenantName, name string) (field.ErrorList, error) {
+	var errs field.ErrorList
+	err := retry.RetryOnConflict(reservationBackoff, func() error {
+		errs = nil
+
+		var quota necotiatorv1beta1.TenantResourceQuota
+		err := v.apiReader.Get(ctx, client.ObjectKey{Name: tenantName}, &quota)
+		if err != nil {
+			return err
+		}
+		if mode := quota.Spec.EnforcementMode; mode == necotiatorv1beta1.EnforcementWarn || mode == necotiatorv1beta1.EnforcementDryRun {
+			return nil
+		}
+		live := quota.DeepCopy()
+		err = v.useLiveAllocation(ctx, live, false)
+		if err != nil {
+			return err
+		}
+		hard, allocated, ok := live.Limit(name, time.Now())
+		if !ok {
+			return nil
+		}
+
+		if violations := tenantLimitViolations(rq, hard, allocated); len(violations) > 0 {
+			errs = tenantLimitErrors(quota.Name, violations)
+			return nil
+		}
+
+		raised := make(corev1.ResourceList)
+		requestedHard := resourcename.WithTotals(resourcename.Translate(rq.Spec.Hard, hard), hard)
+		for resourceName := range hard {
+			requested, ok := requestedHard[resourceName]
+			if !ok || requested.IsZero() {
+				continue
+			}
+			if requested.Cmp(allocated[resourceName].Namespaces[rq.Namespace]) > 0 {
+				raised[resourceName] = requested
+			}
+		}
+		if len(raised) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		quota.Status.SetReservation(necotiatorv1beta1.QuotaReservation{
+			Namespace:     rq.Namespace,
+			ResourceQuota: name,
+			Hard:          raised,
+			ExpiresAt:     metav1.NewTime(now.Add(necotiatorv1beta1.ReservationTTL)),
+		}, now)
+		return v.client.Status().Update(ctx, &quota)
+	})
+	return errs, err
+}
+
+// enforceTenantLimit checks the resource quota against the hard limits of the tenant in the enforcement mode of the tenant.
+// The violations are returned as errors only in the Enforce mode.
+// The Warn mode adds them to the admission warnings, and the DryRun mode records them in the status and the metrics.
+func (v *resourceQuotaValidator) enforceTenantLimit(ctx context.Context, rq *corev1.ResourceQuota, quota *necotiatorv1beta1.TenantResourceQuota, hard corev1.ResourceList, allocated map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage) (field.ErrorList, error) {
+	violations := tenantLimitViolations(rq, hard, allocated)
+	if len(violations) == 0 {
+		return nil, nil
+	}
+
+	switch quota.Spec.EnforcementMode {
+	case necotiatorv1beta1.EnforcementWarn:
+		for _, violation := range violations {
+			addWarning(ctx, tenantLimitMessage(quota.Name, violation))
+		}
+		return nil, nil
+	case necotiatorv1beta1.EnforcementDryRun:
+		v.recordDryRunViolations(ctx, quota.Name, violations)
+		return nil, nil
+	}
+
+	return tenantLimitErrors(quota.Name, violations), nil
+}
+
+// recordDryRunViolations records the violations allowed by the DryRun enforcement mode in the status and the metrics of the tenant.
+// Requests in dry run are not recorded. Failures to record are only logged so that the DryRun mode never denies requests.
+func (v *resourceQuotaValidator) recordDryRunViolations(ctx context.Context, tenantName string, violations []necotiatorv1beta1.TenantLimitViolation) {
+	logger := log.FromContext(ctx)
+	for _, violation := range violations {
+		logger.Info("Allowed exceeding tenant quota in dry run mode", "tenant", tenantName, "message", tenantLimitMessage(tenantName, violation))
+	}
+	request, err := admission.RequestFromContext(ctx)
+	if err == nil && request.DryRun != nil && *request.DryRun {
+		return
+	}
+
+	for _, violation := range violations {
+		dryRunViolationsTotal.WithLabelValues(tenantName, string(violation.Resource)).Inc()
+	}
+	// The tenant is read bypassing the cache, since a stale cache would make every retry conflict.
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var quota necotiatorv1beta1.TenantResourceQuota
+		err := v.apiReader.Get(ctx, client.ObjectKey{Name: tenantName}, &quota)
+		if err != nil {
+			return err
+		}
+		now := metav1.Now()
+		for _, violation := range violations {
+			violation.ObservedAt = now
+			quota.Status.DryRunViolations = setTenantLimitViolation(quota.Status.DryRunViolations, violation)
+		}
+		return v.client.Status().Update(ctx, &quota)
+	})
+	if err != nil {
+		logger.Error(err, "Failed to record dry run violations", "tenant", tenantName)
+	}
+}
+
+// setTenantLimitViolation replaces the violation of the same resource in the same resource quota, or adds the violation to the list.
+func setTenantLimitViolation(violations []necotiatorv1beta1.TenantLimitViolation, violation necotiatorv1beta1.TenantLimitViolation) []necotiatorv1beta1.TenantLimitViolation {
+	for i := range violations {
+		if violations[i].Namespace == violation.Namespace && violations[i].ResourceQuota == violation.ResourceQuota && violations[i].Resource == violation.Resource {
+			violations[i] = violation
+			return violations
+		}
+	}
+	violations = append(violations, violation)
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Namespace != violations[j].Namespace {
+			return violations[i].Namespace < violations[j].Namespace
+		}
+		if violations[i].ResourceQuota != violations[j].ResourceQuota {
+			return violations[i].ResourceQuota < violations[j].ResourceQuota
+		}
+		return violations[i].Resource < violations[j].Resource
+	})
+	return violations
+}
+
+// tenantLimitViolations returns the resources of the resource quota making the total allocation exceed the hard limits of the tenant.
+// Resources are matched with the equivalent names in the hard limits, and the patterns in the hard limits are checked with
+// the totals of the matching resources.
+func tenantLimitViolations(rq *corev1.ResourceQuota, hard corev1.ResourceList, allocated map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage) []necotiatorv1beta1.TenantLimitViolation {
+	var violations []necotiatorv1beta1.TenantLimitViolation
+	for resourceName, requested := range resourcename.WithTotals(resourcename.Translate(rq.Spec.Hard, hard), hard) {
 		allocatedResource := allocated[resourceName]
-		limit, ok := quota.Spec.Hard[resourceName]
+		limit, ok := hard[resourceName]
 		if !ok {
 			continue
 		}
@@ -138,7 +757,7 @@ func (v *resourceQuotaValidator) validate(ctx context.Context, rq *corev1.Resour
 			continue
 		}
 
-		newTotal := allocatedResource.Total
+		newTotal := allocatedResource.Total.DeepCopy()
 		if oldAllocated, ok := allocatedResource.Namespaces[rq.GetNamespace()]; ok {
 			if requested.Cmp(oldAllocated) <= 0 {
 				continue
@@ -148,43 +767,204 @@ func (v *resourceQuotaValidator) validate(ctx context.Context, rq *corev1.Resour
 		newTotal.Add(requested)
 
 		if newTotal.Cmp(limit) > 0 {
+			violations = append(violations, necotiatorv1beta1.TenantLimitViolation{
+				Namespace:     rq.GetNamespace(),
+				ResourceQuota: rq.GetName(),
+				Resource:      resourceName,
+				Requested:     requested,
+				Total:         newTotal,
+				Hard:          limit,
+			})
+		}
+	}
+
+	return violations
+}
+
+// tenantLimitErrors returns the errors denying the violations of the hard limits of the tenant.
+func tenantLimitErrors(tenantName string, violations []necotiatorv1beta1.TenantLimitViolation) field.ErrorList {
+	var errs field.ErrorList
+	for _, violation := range violations {
+		errs = append(errs, field.Forbidden(
+			field.NewPath("spec", "hard", string(violation.Resource)),
+			tenantLimitMessage(tenantName, violation),
+		))
+	}
+	return errs
+}
+
+// tenantLimitMessage returns the message reporting the violation of the hard limits of the tenant.
+func tenantLimitMessage(tenantName string, violation necotiatorv1beta1.TenantLimitViolation) string {
+	return fmt.Sprintf(
+		"exceeded tenant quota: %s, requested: %s=%s, total: %s=%s, limited: %s=%s",
+		tenantName,
+		violation.Resource, violation.Requested.String(),
+		violation.Resource, violation.Total.String(),
+		violation.Resource, violation.Hard.String(),
+	)
+}
+
+// validateUsageGuard checks that the resource quota does not raise allocations while the usage of the tenant is above the threshold.
+func validateUsageGuard(rq *corev1.ResourceQuota, quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	if quota.Spec.UsageGuard == nil || !quota.Spec.UsageGuard.BlockRaises {
+		return nil
+	}
+
+	threshold := quota.UsageThreshold(time.Now())
+	var errs field.ErrorList
+	for resourceName, requested := range rq.Spec.Hard {
+		limit, ok := threshold[resourceName]
+		if !ok {
+			continue
+		}
+		allocated := quota.Status.Allocated[resourceName].Namespaces[rq.GetNamespace()]
+		if requested.Cmp(allocated) <= 0 {
+			continue
+		}
+
+		used := quota.Status.Used[resourceName].Total
+		if used.Cmp(limit) >= 0 {
 			errs = append(errs, field.Forbidden(
 				field.NewPath("spec", "hard", string(resourceName)),
 				fmt.Sprintf(
-					"exceeded tenant quota: %s, requested: %s=%s, total: %s=%s, limited: %s=%s",
-					tenantName,
-					resourceName, requested.String(),
-					resourceName, newTotal.String(),
+					"usage of tenant quota is above the threshold: %s, used: %s=%s, threshold: %s=%s",
+					quota.Name,
+					resourceName, used.String(),
 					resourceName, limit.String(),
 				),
 			))
 		}
 	}
-	for resourceName := range quota.Spec.Hard {
-		if _, ok := rq.Spec.Hard[resourceName]; !ok {
-			errs = append(errs, field.Required(
+
+	return errs
+}
+
+// validateFieldManagers checks that the changed hard limits are owned only by the approved field managers
+// under the Reject field ownership policy.
+func validateFieldManagers(old, rq *corev1.ResourceQuota, quota *necotiatorv1beta1.TenantResourceQuota) (field.ErrorList, error) {
+	if quota.Spec.FieldOwnership != necotiatorv1beta1.FieldOwnershipReject {
+		return nil, nil
+	}
+
+	owners, err := fieldowner.HardOwners(rq)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs field.ErrorList
+	for resourceName, requested := range rq.Spec.Hard {
+		if old != nil {
+			if oldRequested, ok := old.Spec.Hard[resourceName]; ok && requested.Cmp(oldRequested) == 0 {
+				continue
+			}
+		}
+		for _, manager := range owners[resourceName] {
+			if manager == constants.ControllerName || quota.IsApprovedFieldManager(manager) {
+				continue
+			}
+			errs = append(errs, field.Forbidden(
 				field.NewPath("spec", "hard", string(resourceName)),
-				fmt.Sprintf(
-					"required %s by tenant resource quota: %s",
-					resourceName, tenantName,
-				),
+				fmt.Sprintf("field manager %s is not approved by tenant quota: %s", manager, quota.Name),
 			))
 		}
 	}
 
-	if len(errs) > 0 {
-		err := apierrors.NewInvalid(schema.GroupKind{Group: corev1.GroupName, Kind: "ResourceQuota"}, rq.Name, errs)
-		logger.Error(err, "validation error")
-		return err
+	return errs, nil
+}
+
+// validateNamespaceLimits checks that the changed hard limits of the resource quota are within the namespace limits of the tenant.
+// Unchanged values are not checked so that namespaces allocated before the limits are set can be edited.
+func validateNamespaceLimits(old, rq *corev1.ResourceQuota, quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	limits := quota.Spec.NamespaceLimits
+	if limits == nil {
+		return nil
 	}
 
-	return nil
+	var errs field.ErrorList
+	for resourceName, requested := range rq.Spec.Hard {
+		if old != nil {
+			if oldRequested, ok := old.Spec.Hard[resourceName]; ok && requested.Cmp(oldRequested) == 0 {
+				continue
+			}
+		}
+
+		if minHard, ok := limits.Min[resourceName]; ok && !requested.IsZero() && requested.Cmp(minHard) < 0 {
+			errs = append(errs, field.Forbidden(
+				field.NewPath("spec", "hard", string(resourceName)),
+				fmt.Sprintf(
+					"below namespace minimum of tenant quota: %s, requested: %s=%s, min: %s=%s",
+					quota.Name,
+					resourceName, requested.String(),
+					resourceName, minHard.String(),
+				),
+			))
+		}
+		if maxHard, ok := limits.Max[resourceName]; ok && requested.Cmp(maxHard) > 0 {
+			errs = append(errs, field.Forbidden(
+				field.NewPath("spec", "hard", string(resourceName)),
+				fmt.Sprintf(
+					"exceeded namespace maximum of tenant quota: %s, requested: %s=%s, max: %s=%s",
+					quota.Name,
+					resourceName, requested.String(),
+					resourceName, maxHard.String(),
+				),
+			))
+		}
+	}
+
+	return errs
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+// ValidateDelete denies deleting resource quotas labeled by tenants except by the controller and the deleter groups.
+// Resource quotas in terminating namespaces can be deleted so that the namespaces are removed.
 func (r *resourceQuotaValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
 	resourcequotalog.Info("validate delete")
 
-	// TODO(user): fill in your validation logic upon object deletion.
-	return nil
+	rq, ok := obj.(*corev1.ResourceQuota)
+	if !ok {
+		return fmt.Errorf("unknown obj type %T", obj)
+	}
+	tenantName, ok := rq.Labels[constants.LabelTenant]
+	if !ok {
+		return nil
+	}
+
+	request, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	byController, err := r.requestedByController(ctx)
+	if err != nil {
+		return err
+	}
+	if byController {
+		return nil
+	}
+	for _, group := range request.UserInfo.Groups {
+		for _, deleterGroup := range r.deleterGroups {
+			if group == deleterGroup {
+				return nil
+			}
+		}
+	}
+
+	var ns corev1.Namespace
+	err = r.client.Get(ctx, client.ObjectKey{Name: rq.Namespace}, &ns)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !ns.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	err = apierrors.NewForbidden(
+		schema.GroupResource{Group: corev1.GroupName, Resource: "resourcequotas"},
+		rq.Name,
+		fmt.Errorf("managed by tenant resource quota: %s", tenantName),
+	)
+	log.FromContext(ctx).Error(err, "validation error")
+	return err
 }
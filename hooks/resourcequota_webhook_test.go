@@ -1,16 +1,27 @@
 package hooks
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
+	"github.com/cybozu-go/necotiator/controllers"
 	"github.com/cybozu-go/necotiator/pkg/constants"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var (
@@ -28,11 +39,16 @@ func newTestObjectName() string {
 var _ = Describe("Webhook Table Test", func() {
 
 	type testCase struct {
-		limit     corev1.ResourceList
-		allocated map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage
-		request   corev1.ResourceList
-		allow     bool
-		message   string
+		limit           corev1.ResourceList
+		hardPatterns    corev1.ResourceList
+		namespaceLimits *necotiatorv1beta1.NamespaceLimits
+		overcommit      map[corev1.ResourceName]int32
+		usageGuard      *necotiatorv1beta1.UsageGuard
+		allocated       map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage
+		used            map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage
+		request         corev1.ResourceList
+		allow           bool
+		message         string
 	}
 
 	mainNamespace := "__MAIN_NAMESPACE__"
@@ -53,7 +69,11 @@ var _ = Describe("Webhook Table Test", func() {
 				Name: tenantResourceQuotaName,
 			},
 			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
-				Hard: testCase.limit,
+				Hard:            testCase.limit,
+				HardPatterns:    testCase.hardPatterns,
+				NamespaceLimits: testCase.namespaceLimits,
+				Overcommit:      testCase.overcommit,
+				UsageGuard:      testCase.usageGuard,
 			},
 		}
 		err = k8sClient.Create(ctx, tenantResourceQuota)
@@ -68,6 +88,7 @@ var _ = Describe("Webhook Table Test", func() {
 		}
 		tenantResourceQuota.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
 			Allocated: testCase.allocated,
+			Used:      testCase.used,
 		}
 		err = k8sClient.Status().Update(ctx, tenantResourceQuota)
 		Expect(err).ShouldNot(HaveOccurred())
@@ -143,6 +164,27 @@ var _ = Describe("Webhook Table Test", func() {
 			request: corev1.ResourceList{},
 			message: "required limits.cpu by tenant resource quota: %s",
 		}),
+		Entry("should deny resource equivalent to tenant limit", testCase{
+			limit: corev1.ResourceList{
+				"requests.cpu": resource.MustParse("500m"),
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{},
+			request: corev1.ResourceList{
+				"cpu":          resource.MustParse("1"),
+				"requests.cpu": resource.MustParse("100m"),
+			},
+			message: "equivalent to requests.cpu limited by tenant resource quota: %s",
+		}),
+		Entry("should deny exceeded quota by equivalent resource", testCase{
+			limit: corev1.ResourceList{
+				"requests.memory": resource.MustParse("1Gi"),
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{},
+			request: corev1.ResourceList{
+				"memory": resource.MustParse("2Gi"),
+			},
+			message: "exceeded tenant quota: %s, requested: requests.memory=2Gi, total: requests.memory=2Gi, limited: requests.memory=1Gi",
+		}),
 		Entry("should deny exceeded quota if status is empty", testCase{
 			limit: corev1.ResourceList{
 				"limits.cpu": resource.MustParse("500m"),
@@ -241,26 +283,208 @@ var _ = Describe("Webhook Table Test", func() {
 			},
 			allow: true,
 		}),
-	)
-
-	It("should deny change label", func() {
-		testCase := testCase{
+		Entry("should deny quota below namespace minimum", testCase{
+			limit: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("1"),
+			},
+			namespaceLimits: &necotiatorv1beta1.NamespaceLimits{
+				Min: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{},
+			request: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("50m"),
+			},
+			message: "below namespace minimum of tenant quota: %s, requested: limits.cpu=50m, min: limits.cpu=100m",
+		}),
+		Entry("should deny quota above namespace maximum", testCase{
+			limit: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("1"),
+			},
+			namespaceLimits: &necotiatorv1beta1.NamespaceLimits{
+				Max: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("300m"),
+				},
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{},
+			request: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("500m"),
+			},
+			message: "exceeded namespace maximum of tenant quota: %s, requested: limits.cpu=500m, max: limits.cpu=300m",
+		}),
+		Entry("should allow zero quota below namespace minimum", testCase{
+			limit: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("1"),
+			},
+			namespaceLimits: &necotiatorv1beta1.NamespaceLimits{
+				Min: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{},
+			request: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("0"),
+			},
+			allow: true,
+		}),
+		Entry("should allow quota within namespace limits", testCase{
 			limit: corev1.ResourceList{
 				"limits.cpu": resource.MustParse("1"),
 			},
+			namespaceLimits: &necotiatorv1beta1.NamespaceLimits{
+				Min: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+				Max: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("300m"),
+				},
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{},
+			request: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("200m"),
+			},
+			allow: true,
+		}),
+		Entry("should allow overcommitted quota", testCase{
+			limit: corev1.ResourceList{
+				"count/configmaps": resource.MustParse("10"),
+			},
+			overcommit: map[corev1.ResourceName]int32{
+				"count/configmaps": 150,
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"count/configmaps": {
+					Total: resource.MustParse("10"),
+					Namespaces: map[string]resource.Quantity{
+						newTestObjectName(): resource.MustParse("10"),
+					},
+				},
+			},
+			request: corev1.ResourceList{
+				"count/configmaps": resource.MustParse("5"),
+			},
+			allow: true,
+		}),
+		Entry("should deny exceeded overcommitted quota", testCase{
+			limit: corev1.ResourceList{
+				"count/configmaps": resource.MustParse("10"),
+			},
+			overcommit: map[corev1.ResourceName]int32{
+				"count/configmaps": 150,
+			},
 			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"count/configmaps": {
+					Total: resource.MustParse("10"),
+					Namespaces: map[string]resource.Quantity{
+						newTestObjectName(): resource.MustParse("10"),
+					},
+				},
+			},
+			request: corev1.ResourceList{
+				"count/configmaps": resource.MustParse("6"),
+			},
+			message: "exceeded tenant quota: %s, requested: count/configmaps=6, total: count/configmaps=16, limited: count/configmaps=15",
+		}),
+		Entry("should deny raising quota while usage is above threshold", testCase{
+			limit: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("1"),
+			},
+			usageGuard: &necotiatorv1beta1.UsageGuard{
+				ThresholdPercent: 80,
+				BlockRaises:      true,
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{},
+			used: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
 				"limits.cpu": {
-					Total: resource.MustParse("0"),
+					Total: resource.MustParse("900m"),
+				},
+			},
+			request: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("100m"),
+			},
+			message: "usage of tenant quota is above the threshold: %s, used: limits.cpu=900m, threshold: limits.cpu=800m",
+		}),
+		Entry("should allow raising quota while usage is above threshold without blocking", testCase{
+			limit: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("1"),
+			},
+			usageGuard: &necotiatorv1beta1.UsageGuard{
+				ThresholdPercent: 80,
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{},
+			used: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"limits.cpu": {
+					Total: resource.MustParse("900m"),
+				},
+			},
+			request: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("100m"),
+			},
+			allow: true,
+		}),
+		Entry("should deny exceeded total of hard pattern", testCase{
+			limit: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("1"),
+			},
+			hardPatterns: corev1.ResourceList{
+				"*.storageclass.storage.k8s.io/requests.storage": resource.MustParse("5Gi"),
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"*.storageclass.storage.k8s.io/requests.storage": {
+					Total: resource.MustParse("3Gi"),
 					Namespaces: map[string]resource.Quantity{
-						mainNamespace: resource.MustParse("0"),
+						"dummy": resource.MustParse("3Gi"),
 					},
 				},
 			},
 			request: corev1.ResourceList{
-				"limits.cpu": resource.MustParse("600m"),
+				"limits.cpu": resource.MustParse("100m"),
+				"gold.storageclass.storage.k8s.io/requests.storage":   resource.MustParse("1Gi"),
+				"silver.storageclass.storage.k8s.io/requests.storage": resource.MustParse("2Gi"),
 			},
-			message: `ResourceQuota "default" is invalid: metadata.labels.necotiator.cybozu.io/tenant: Forbidden: tenant labels is immutable`,
-		}
+			message: "exceeded tenant quota: %s, requested: *.storageclass.storage.k8s.io/requests.storage=3Gi, total: *.storageclass.storage.k8s.io/requests.storage=6Gi, limited: *.storageclass.storage.k8s.io/requests.storage=5Gi",
+		}),
+		Entry("should allow total of hard pattern within limit", testCase{
+			limit: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("1"),
+			},
+			hardPatterns: corev1.ResourceList{
+				"count/*": resource.MustParse("10"),
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"count/*": {
+					Total: resource.MustParse("5"),
+					Namespaces: map[string]resource.Quantity{
+						"dummy": resource.MustParse("5"),
+					},
+				},
+			},
+			request: corev1.ResourceList{
+				"limits.cpu":             resource.MustParse("100m"),
+				"count/pods":             resource.MustParse("3"),
+				"count/deployments.apps": resource.MustParse("2"),
+			},
+			allow: true,
+		}),
+		Entry("should deny exceeded hard limit matching hard pattern", testCase{
+			limit: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("1"),
+				"count/pods": resource.MustParse("2"),
+			},
+			hardPatterns: corev1.ResourceList{
+				"count/*": resource.MustParse("10"),
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{},
+			request: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("100m"),
+				"count/pods": resource.MustParse("3"),
+			},
+			message: "exceeded tenant quota: %s, requested: count/pods=3, total: count/pods=3, limited: count/pods=2",
+		}),
+	)
+
+	It("should deny exceeded quota of ancestor tenant", func() {
 		namespaceName := newTestObjectName()
 		namespace := &corev1.Namespace{
 			ObjectMeta: metav1.ObjectMeta{
@@ -270,34 +494,138 @@ var _ = Describe("Webhook Table Test", func() {
 		err := k8sClient.Create(ctx, namespace)
 		Expect(err).ShouldNot(HaveOccurred())
 
+		grandparentName := newTestObjectName()
+		grandparent := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: grandparentName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("500m"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, grandparent)
+		Expect(err).ShouldNot(HaveOccurred())
+		grandparent.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
+			Allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"limits.cpu": {
+					Total: resource.MustParse("400m"),
+					Namespaces: map[string]resource.Quantity{
+						namespaceName:       resource.MustParse("0"),
+						newTestObjectName(): resource.MustParse("400m"),
+					},
+				},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, grandparent)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		parentName := newTestObjectName()
+		parent := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: parentName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+				Parent: grandparentName,
+			},
+		}
+		err = k8sClient.Create(ctx, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+
 		tenantResourceQuotaName := newTestObjectName()
 		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: tenantResourceQuotaName,
 			},
 			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
-				Hard: testCase.limit,
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+				Parent: parentName,
 			},
 		}
 		err = k8sClient.Create(ctx, tenantResourceQuota)
 		Expect(err).ShouldNot(HaveOccurred())
 
-		for resourceName, usage := range testCase.allocated {
-			if v, ok := usage.Namespaces[mainNamespace]; ok {
-				usage.Namespaces[namespaceName] = v
-				delete(usage.Namespaces, mainNamespace)
-			}
-			testCase.allocated[resourceName] = usage
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels: map[string]string{
+					constants.LabelCreatedBy: constants.CreatedBy,
+					constants.LabelTenant:    tenantResourceQuotaName,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("200m"),
+				},
+			},
 		}
-		tenantResourceQuota.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
-			Allocated: testCase.allocated,
+		err = k8sClient.Create(ctx, resourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(fmt.Sprintf("exceeded tenant quota: %s, requested: limits.cpu=200m, total: limits.cpu=600m, limited: limits.cpu=500m", grandparentName))))
+	})
+
+	It("should deny exceeded quota of parent tenant managing resource quotas of different name", func() {
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
 		}
-		err = k8sClient.Status().Update(ctx, tenantResourceQuota)
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		parentName := newTestObjectName()
+		parent := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: parentName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("500m"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+		parent.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
+			Allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"limits.cpu": {
+					Total: resource.MustParse("400m"),
+					Namespaces: map[string]resource.Quantity{
+						newTestObjectName(): resource.MustParse("400m"),
+					},
+				},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+				Parent:            parentName,
+				ResourceQuotaName: "compute",
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
 		Expect(err).ShouldNot(HaveOccurred())
 
 		resourceQuota := &corev1.ResourceQuota{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      constants.ResourceQuotaNameDefault,
+				Name:      "compute",
 				Namespace: namespaceName,
 				Labels: map[string]string{
 					constants.LabelCreatedBy: constants.CreatedBy,
@@ -305,15 +633,841 @@ var _ = Describe("Webhook Table Test", func() {
 				},
 			},
 			Spec: corev1.ResourceQuotaSpec{
-				Hard: testCase.request,
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("200m"),
+				},
 			},
 		}
 		err = k8sClient.Create(ctx, resourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(fmt.Sprintf("exceeded tenant quota: %s, requested: limits.cpu=200m, total: limits.cpu=600m, limited: limits.cpu=500m", parentName))))
+
+		resourceQuota.Spec.Hard["limits.cpu"] = resource.MustParse("100m")
+		err = k8sClient.Create(ctx, resourceQuota)
 		Expect(err).ShouldNot(HaveOccurred())
 
-		resourceQuota.ObjectMeta.Labels[constants.LabelTenant] = "user-defined"
-		err = k8sClient.Update(ctx, resourceQuota)
-		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
-		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(testCase.message)))
+		By("recording the reservation under the name of the resource quotas of the parent")
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: parentName}, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(parent.Status.Reservations).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Namespace":     Equal(namespaceName),
+			"ResourceQuota": Equal(constants.ResourceQuotaNameDefault),
+		})))
 	})
-})
+
+	It("should enforce scoped quotas independently", func() {
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"pods": resource.MustParse("10"),
+				},
+				ScopedQuotas: []necotiatorv1beta1.ScopedQuota{
+					{
+						Name:   "best-effort",
+						Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+						Hard: corev1.ResourceList{
+							"pods": resource.MustParse("2"),
+						},
+					},
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		tenantResourceQuota.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
+			ScopedQuotas: []necotiatorv1beta1.ScopedQuotaStatus{
+				{
+					Name: "best-effort",
+					Allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+						"pods": {
+							Total: resource.MustParse("2"),
+							Namespaces: map[string]resource.Quantity{
+								newTestObjectName(): resource.MustParse("2"),
+							},
+						},
+					},
+				},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		labels := map[string]string{
+			constants.LabelCreatedBy: constants.CreatedBy,
+			constants.LabelTenant:    tenantResourceQuotaName,
+		}
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels:    labels,
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"pods": resource.MustParse("5"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		scopedResourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "best-effort",
+				Namespace: namespaceName,
+				Labels:    labels,
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"pods": resource.MustParse("1"),
+				},
+				Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+			},
+		}
+		err = k8sClient.Create(ctx, scopedResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(fmt.Sprintf("exceeded tenant quota: %s, requested: pods=1, total: pods=3, limited: pods=2", tenantResourceQuotaName))))
+	})
+
+	It("should deny change label", func() {
+		testCase := testCase{
+			limit: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("1"),
+			},
+			allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"limits.cpu": {
+					Total: resource.MustParse("0"),
+					Namespaces: map[string]resource.Quantity{
+						mainNamespace: resource.MustParse("0"),
+					},
+				},
+			},
+			request: corev1.ResourceList{
+				"limits.cpu": resource.MustParse("600m"),
+			},
+			message: `ResourceQuota "default" is invalid: metadata.labels.necotiator.cybozu.io/tenant: Forbidden: tenant labels is immutable`,
+		}
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: testCase.limit,
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		for resourceName, usage := range testCase.allocated {
+			if v, ok := usage.Namespaces[mainNamespace]; ok {
+				usage.Namespaces[namespaceName] = v
+				delete(usage.Namespaces, mainNamespace)
+			}
+			testCase.allocated[resourceName] = usage
+		}
+		tenantResourceQuota.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
+			Allocated: testCase.allocated,
+			Used:      testCase.used,
+		}
+		err = k8sClient.Status().Update(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels: map[string]string{
+					constants.LabelCreatedBy: constants.CreatedBy,
+					constants.LabelTenant:    tenantResourceQuotaName,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: testCase.request,
+			},
+		}
+		err = k8sClient.Create(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota.ObjectMeta.Labels[constants.LabelTenant] = "user-defined"
+		err = k8sClient.Update(ctx, resourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(testCase.message)))
+	})
+
+	It("should deny hard limits set by unapproved field manager", func() {
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+				FieldOwnership:        necotiatorv1beta1.FieldOwnershipReject,
+				ApprovedFieldManagers: []string{"approved-tool"},
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels: map[string]string{
+					constants.LabelCreatedBy: constants.CreatedBy,
+					constants.LabelTenant:    tenantResourceQuotaName,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, resourceQuota, client.FieldOwner("approved-tool"))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota.Spec.Hard["limits.cpu"] = resource.MustParse("200m")
+		err = k8sClient.Update(ctx, resourceQuota, client.FieldOwner("unapproved-tool"))
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(fmt.Sprintf("field manager unapproved-tool is not approved by tenant quota: %s", tenantResourceQuotaName))))
+
+		err = k8sClient.Update(ctx, resourceQuota, client.FieldOwner("approved-tool"))
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should deny deleting resource quota managed by tenant", func() {
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels: map[string]string{
+					constants.LabelCreatedBy: constants.CreatedBy,
+					constants.LabelTenant:    tenantResourceQuotaName,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = k8sClient.Delete(ctx, resourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonForbidden)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(fmt.Sprintf("managed by tenant resource quota: %s", tenantResourceQuotaName))))
+
+		deleterCfg := rest.CopyConfig(cfg)
+		deleterCfg.Impersonate = rest.ImpersonationConfig{
+			UserName: "quota-deleter",
+			Groups:   []string{"system:masters", "necotiator:quota-deleters"},
+		}
+		deleterClient, err := client.New(deleterCfg, client.Options{Scheme: k8sClient.Scheme()})
+		Expect(err).ShouldNot(HaveOccurred())
+		err = deleterClient.Delete(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should allow bypass identity to change label with an event", func() {
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels: map[string]string{
+					constants.LabelCreatedBy: constants.CreatedBy,
+					constants.LabelTenant:    tenantResourceQuotaName,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		migrationCfg := rest.CopyConfig(cfg)
+		migrationCfg.Impersonate = rest.ImpersonationConfig{
+			UserName: "migration-tool",
+			Groups:   []string{"system:masters"},
+		}
+		migrationClient, err := client.New(migrationCfg, client.Options{Scheme: k8sClient.Scheme()})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		delete(resourceQuota.Labels, constants.LabelTenant)
+		err = migrationClient.Update(ctx, resourceQuota.DeepCopy(), client.DryRunAll)
+		Expect(err).ShouldNot(HaveOccurred())
+		err = migrationClient.Update(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		bypassedOnce := func(g Gomega) {
+			var events corev1.EventList
+			err := k8sClient.List(ctx, &events, client.InNamespace(metav1.NamespaceDefault))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(events.Items).Should(ContainElement(MatchFields(IgnoreExtras, Fields{
+				"InvolvedObject": MatchFields(IgnoreExtras, Fields{
+					"Name": Equal(tenantResourceQuotaName),
+				}),
+				"Reason":  Equal("ValidationBypassed"),
+				"Message": ContainSubstring("User migration-tool bypassed label immutability"),
+				"Count":   BeNumerically("==", 1),
+			})))
+		}
+		Eventually(bypassedOnce).Should(Succeed())
+		Consistently(bypassedOnce, 2*time.Second).Should(Succeed())
+	})
+
+	It("should allow exceeded quota with warnings in Warn mode", func() {
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+				EnforcementMode: necotiatorv1beta1.EnforcementWarn,
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		warnings := &warningRecorder{}
+		warningCfg := rest.CopyConfig(cfg)
+		warningCfg.WarningHandler = warnings
+		warningClient, err := client.New(warningCfg, client.Options{Scheme: k8sClient.Scheme()})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels: map[string]string{
+					constants.LabelCreatedBy: constants.CreatedBy,
+					constants.LabelTenant:    tenantResourceQuotaName,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("200m"),
+				},
+			},
+		}
+		err = warningClient.Create(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(warnings.messages).Should(ConsistOf(ContainSubstring("exceeded tenant quota: " + tenantResourceQuotaName)))
+	})
+
+	It("should record exceeded quota in status in DryRun mode", func() {
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+				EnforcementMode: necotiatorv1beta1.EnforcementDryRun,
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels: map[string]string{
+					constants.LabelCreatedBy: constants.CreatedBy,
+					constants.LabelTenant:    tenantResourceQuotaName,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("200m"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		quantityString := func(q resource.Quantity) string { return q.String() }
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(tenantResourceQuota.Status.DryRunViolations).Should(ConsistOf(MatchFields(IgnoreExtras, Fields{
+				"Namespace":     Equal(namespaceName),
+				"ResourceQuota": Equal(constants.ResourceQuotaNameDefault),
+				"Resource":      Equal(corev1.ResourceName("limits.cpu")),
+				"Requested":     WithTransform(quantityString, Equal("200m")),
+				"Hard":          WithTransform(quantityString, Equal("100m")),
+			})))
+		}).Should(Succeed())
+	})
+
+	It("should not exceed tenant quota with concurrent raises", func() {
+		// The controller updates the status of the tenant concurrently with the reservations of the webhook.
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             k8sClient.Scheme(),
+			LeaderElection:     false,
+			MetricsBindAddress: "0",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		err = (&controllers.TenantResourceQuotaReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor(constants.EventRecorderName),
+		}).SetupWithManager(ctx, mgr)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mgrCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go func() {
+			defer GinkgoRecover()
+			err := mgr.Start(mgrCtx)
+			Expect(err).ShouldNot(HaveOccurred())
+		}()
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"team": tenantResourceQuotaName,
+					},
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		const parallelism = 10
+		namespaceNames := make([]string, parallelism)
+		for i := range namespaceNames {
+			namespaceNames[i] = newTestObjectName()
+			err := k8sClient.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: namespaceNames[i],
+					Labels: map[string]string{
+						"team": tenantResourceQuotaName,
+					},
+				},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		for _, namespaceName := range namespaceNames {
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKey{Namespace: namespaceName, Name: constants.ResourceQuotaNameDefault}, &corev1.ResourceQuota{})
+			}).Should(Succeed())
+		}
+
+		var admitted int32
+		var wg sync.WaitGroup
+		for _, namespaceName := range namespaceNames {
+			wg.Add(1)
+			go func(namespaceName string) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+					var resourceQuota corev1.ResourceQuota
+					err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespaceName, Name: constants.ResourceQuotaNameDefault}, &resourceQuota)
+					if err != nil {
+						return err
+					}
+					resourceQuota.Spec.Hard = corev1.ResourceList{
+						"limits.cpu": resource.MustParse("300m"),
+					}
+					return k8sClient.Update(ctx, &resourceQuota)
+				})
+				if err == nil {
+					atomic.AddInt32(&admitted, 1)
+					return
+				}
+				Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("exceeded tenant quota: " + tenantResourceQuotaName)))
+			}(namespaceName)
+		}
+		wg.Wait()
+
+		Expect(admitted).Should(BeEquivalentTo(3))
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(tenantResourceQuota.Status.Reservations).Should(HaveLen(3))
+
+		conditionStatus := func(conditionType string) func() metav1.ConditionStatus {
+			return func() metav1.ConditionStatus {
+				var quota necotiatorv1beta1.TenantResourceQuota
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, &quota)
+				Expect(err).ShouldNot(HaveOccurred())
+				condition := meta.FindStatusCondition(quota.Status.Conditions, conditionType)
+				if condition == nil {
+					return metav1.ConditionUnknown
+				}
+				return condition.Status
+			}
+		}
+		Eventually(conditionStatus(necotiatorv1beta1.ConditionReady)).Should(Equal(metav1.ConditionTrue))
+		Consistently(conditionStatus(necotiatorv1beta1.ConditionDegraded), 2*time.Second).ShouldNot(Equal(metav1.ConditionTrue))
+	})
+
+	It("should compute live allocation from resource quotas in selected namespaces and report drift", func() {
+		parentName := newTestObjectName()
+		parent := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: parentName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"team": parentName,
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		childName := newTestObjectName()
+		child := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: childName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"team": childName,
+					},
+				},
+				Parent: parentName,
+			},
+		}
+		err = k8sClient.Create(ctx, child)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		parentNamespace := newTestObjectName()
+		childNamespace := newTestObjectName()
+		unselectedNamespace := newTestObjectName()
+		for namespaceName, team := range map[string]string{parentNamespace: parentName, childNamespace: childName, unselectedNamespace: ""} {
+			err := k8sClient.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: namespaceName,
+					Labels: map[string]string{
+						"team": team,
+					},
+				},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			tenantName := team
+			if tenantName == "" {
+				tenantName = parentName
+			}
+			resourceQuota := &corev1.ResourceQuota{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      constants.ResourceQuotaNameDefault,
+					Namespace: namespaceName,
+					Labels: map[string]string{
+						constants.LabelCreatedBy: constants.CreatedBy,
+						constants.LabelTenant:    tenantName,
+					},
+				},
+				Spec: corev1.ResourceQuotaSpec{
+					Hard: corev1.ResourceList{
+						"limits.cpu": resource.MustParse("200m"),
+					},
+				},
+			}
+			err = k8sClient.Create(ctx, resourceQuota)
+			Expect(err).ShouldNot(HaveOccurred())
+			resourceQuota.Status.Hard = corev1.ResourceList{
+				"limits.cpu": resource.MustParse("100m"),
+			}
+			err = k8sClient.Status().Update(ctx, resourceQuota)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: parentName}, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+		parent.Status.Allocated = map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+			"limits.cpu": {
+				Total: resource.MustParse("100m"),
+				Namespaces: map[string]resource.Quantity{
+					parentNamespace: resource.MustParse("100m"),
+				},
+			},
+		}
+
+		recorder := record.NewFakeRecorder(10)
+		validator := &resourceQuotaValidator{
+			client:         k8sClient,
+			recorder:       recorder,
+			liveAllocation: true,
+		}
+		err = validator.useLiveAllocation(ctx, parent, true)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		usage := parent.Status.Allocated["limits.cpu"]
+		Expect(usage.Total.String()).Should(Equal("400m"))
+		Expect(usage.Namespaces).Should(HaveKey(parentNamespace))
+		Expect(usage.Namespaces).Should(HaveKey(childNamespace))
+		Expect(usage.Namespaces).ShouldNot(HaveKey(unselectedNamespace))
+		Expect(recorder.Events).Should(Receive(ContainSubstring("limits.cpu (computed: 200m, status: 100m)")))
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: parentName}, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+		parent.Status.Allocated = map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+			"limits.cpu": {
+				Total: resource.MustParse("100m"),
+			},
+		}
+		err = validator.useLiveAllocation(ctx, parent, true)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(recorder.Events).ShouldNot(Receive())
+	})
+
+	It("should allow missing resource in grace period with warnings", func() {
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu":              resource.MustParse("1"),
+					"requests.nvidia.com/gpu": resource.MustParse("4"),
+				},
+				MissingResourceGracePeriod: &metav1.Duration{Duration: time.Hour},
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		warnings := &warningRecorder{}
+		warningCfg := rest.CopyConfig(cfg)
+		warningCfg.WarningHandler = warnings
+		warningClient, err := client.New(warningCfg, client.Options{Scheme: k8sClient.Scheme()})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels: map[string]string{
+					constants.LabelCreatedBy: constants.CreatedBy,
+					constants.LabelTenant:    tenantResourceQuotaName,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("100m"),
+				},
+			},
+		}
+		err = warningClient.Create(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(warnings.messages).Should(ConsistOf(ContainSubstring("missing requests.nvidia.com/gpu required by tenant resource quota: " + tenantResourceQuotaName)))
+
+		delete(resourceQuota.Spec.Hard, "limits.cpu")
+		err = k8sClient.Update(ctx, resourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("required limits.cpu by tenant resource quota: " + tenantResourceQuotaName)))
+	})
+
+	It("should start missing resource grace period for each namespace", func() {
+		namespaceName := newTestObjectName()
+		namespaceName2 := newTestObjectName()
+		for _, name := range []string{namespaceName, namespaceName2} {
+			err := k8sClient.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu":              resource.MustParse("1"),
+					"requests.nvidia.com/gpu": resource.MustParse("4"),
+				},
+				MissingResourceGracePeriod: &metav1.Duration{Duration: time.Hour},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		tenantResourceQuota.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
+			MissingResources: []necotiatorv1beta1.MissingResource{
+				{
+					ResourceQuota: constants.ResourceQuotaNameDefault,
+					Resource:      "requests.nvidia.com/gpu",
+					Namespaces:    []string{namespaceName},
+					Since:         metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+				},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		newResourceQuota := func(namespace string) *corev1.ResourceQuota {
+			return &corev1.ResourceQuota{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      constants.ResourceQuotaNameDefault,
+					Namespace: namespace,
+					Labels: map[string]string{
+						constants.LabelCreatedBy: constants.CreatedBy,
+						constants.LabelTenant:    tenantResourceQuotaName,
+					},
+				},
+				Spec: corev1.ResourceQuotaSpec{
+					Hard: corev1.ResourceList{
+						"limits.cpu": resource.MustParse("100m"),
+					},
+				},
+			}
+		}
+		err = k8sClient.Create(ctx, newResourceQuota(namespaceName))
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("required requests.nvidia.com/gpu by tenant resource quota: " + tenantResourceQuotaName)))
+
+		err = k8sClient.Create(ctx, newResourceQuota(namespaceName2))
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+})
+
+// warningRecorder records the warnings returned by the API server.
+type warningRecorder struct {
+	messages []string
+}
+
+func (r *warningRecorder) HandleWarningHeader(code int, agent string, message string) {
+	r.messages = append(r.messages, message)
+}
@@ -19,10 +19,22 @@ package hooks
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/cybozu-go/necotiator/pkg/constants"
+	"github.com/cybozu-go/necotiator/pkg/resourcename"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -37,10 +49,17 @@ var tenantresourcequotalog = logf.Log.WithName("tenantresourcequota-resource")
 type tenantResourceQuotaMutator struct {
 }
 
+// tenantResourceQuotaValidator reads objects bypassing the cache
+// so that tenant resource quotas applied together can refer to each other.
+type tenantResourceQuotaValidator struct {
+	reader client.Reader
+}
+
 func SetupTenantResourceQuotaWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(&necotiatorv1beta1.TenantResourceQuota{}).
 		WithDefaulter(&tenantResourceQuotaMutator{}).
+		WithValidator(&tenantResourceQuotaValidator{mgr.GetAPIReader()}).
 		Complete()
 }
 
@@ -66,3 +85,446 @@ func (m *tenantResourceQuotaMutator) Default(ctx context.Context, obj runtime.Ob
 
 	return nil
 }
+
+//+kubebuilder:webhook:path=/validate-necotiator-cybozu-io-v1beta1-tenantresourcequota,mutating=false,failurePolicy=fail,sideEffects=None,groups=necotiator.cybozu.io,resources=tenantresourcequotas,verbs=create;update,versions=v1beta1,name=vtenantresourcequota.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomValidator = &tenantResourceQuotaValidator{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (v *tenantResourceQuotaValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	tenantresourcequotalog.Info("validate create")
+
+	quota, ok := obj.(*necotiatorv1beta1.TenantResourceQuota)
+	if !ok {
+		return fmt.Errorf("unknown obj type: %T", obj)
+	}
+
+	return v.validate(ctx, nil, quota)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (v *tenantResourceQuotaValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	tenantresourcequotalog.Info("validate update")
+
+	quota, ok := newObj.(*necotiatorv1beta1.TenantResourceQuota)
+	if !ok {
+		return fmt.Errorf("unknown newObj type %T", newObj)
+	}
+	old, ok := oldObj.(*necotiatorv1beta1.TenantResourceQuota)
+	if !ok {
+		return fmt.Errorf("unknown oldObj type %T", oldObj)
+	}
+
+	return v.validate(ctx, old, quota)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (v *tenantResourceQuotaValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// validate checks the tenant resource quota. old is nil on creation.
+// Deleting tenant resource quotas are not checked so that the finalizer can be removed.
+func (v *tenantResourceQuotaValidator) validate(ctx context.Context, old, quota *necotiatorv1beta1.TenantResourceQuota) error {
+	logger := log.FromContext(ctx)
+
+	if quota.DeletionTimestamp != nil {
+		return nil
+	}
+
+	var errs field.ErrorList
+	if old != nil && !forced(old, quota) {
+		errs = append(errs, validateHardNotBelowAllocated(old, quota)...)
+	}
+	if old != nil {
+		errs = append(errs, validateResourceQuotaName(old, quota)...)
+	}
+	errs = append(errs, validateNamespaceDefaults(quota)...)
+	errs = append(errs, validateScopedQuotas(quota)...)
+	errs = append(errs, validateOvercommit(quota)...)
+	errs = append(errs, validateSchedules(quota)...)
+	errs = append(errs, validateReclaim(quota)...)
+	errs = append(errs, validateNamespaceWeights(quota)...)
+	errs = append(errs, validateMissingResourceGracePeriod(quota)...)
+	errs = append(errs, validateResourceNameDuplicates(quota)...)
+	errs = append(errs, validateHardPatterns(quota)...)
+	errs = append(errs, validateLeases(quota)...)
+
+	// The namespace selector and the parent refer to other objects, so they are checked only when changed.
+	// Otherwise a change in the other objects would deny every update of the tenant resource quota.
+	if old == nil || !equality.Semantic.DeepEqual(old.Spec.NamespaceSelector, quota.Spec.NamespaceSelector) || old.Spec.Priority != quota.Spec.Priority {
+		selectorErrs, err := v.validateNamespaceSelector(ctx, quota)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, selectorErrs...)
+	}
+
+	if old == nil || old.Spec.Parent != quota.Spec.Parent {
+		parentErrs, err := v.validateParent(ctx, quota)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, parentErrs...)
+	}
+
+	if len(errs) > 0 {
+		err := apierrors.NewInvalid(schema.GroupKind{Group: necotiatorv1beta1.GroupVersion.Group, Kind: "TenantResourceQuota"}, quota.Name, errs)
+		logger.Error(err, "validation error")
+		return err
+	}
+
+	return nil
+}
+
+// forced returns true if the update adds the force annotation.
+// The annotation left on the tenant resource quota does not force the later updates.
+func forced(old, quota *necotiatorv1beta1.TenantResourceQuota) bool {
+	return old.Annotations[constants.AnnotationForce] != "true" && quota.Annotations[constants.AnnotationForce] == "true"
+}
+
+// validateHardNotBelowAllocated checks that the allocatable hard limits and the hard patterns are not lowered below the current allocation.
+func validateHardNotBelowAllocated(old, quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	allocatable := quota.AllocatableHard(time.Now())
+	oldAllocatable := old.AllocatableHard(time.Now())
+
+	var errs field.ErrorList
+	for resourceName, allocated := range old.Status.Allocated {
+		hard, ok := allocatable[resourceName]
+		if !ok {
+			continue
+		}
+		if oldHard, ok := oldAllocatable[resourceName]; ok && hard.Cmp(oldHard) >= 0 {
+			continue
+		}
+		if hard.Cmp(allocated.Total) < 0 {
+			errs = append(errs, field.Forbidden(
+				field.NewPath("spec", "hard", string(resourceName)),
+				fmt.Sprintf(
+					"hard limit is below the allocated resources: hard: %s=%s, allocated: %s=%s, add annotation %s=true in the same update to force",
+					resourceName, hard.String(),
+					resourceName, allocated.Total.String(),
+					constants.AnnotationForce,
+				),
+			))
+		}
+	}
+	for pattern, hard := range quota.Spec.HardPatterns {
+		allocated, ok := old.Status.Allocated[pattern]
+		if !ok {
+			continue
+		}
+		if oldHard, ok := old.Spec.HardPatterns[pattern]; ok && hard.Cmp(oldHard) >= 0 {
+			continue
+		}
+		if hard.Cmp(allocated.Total) < 0 {
+			errs = append(errs, field.Forbidden(
+				field.NewPath("spec", "hardPatterns", string(pattern)),
+				fmt.Sprintf(
+					"hard limit is below the allocated resources: hard: %s=%s, allocated: %s=%s, add annotation %s=true in the same update to force",
+					pattern, hard.String(),
+					pattern, allocated.Total.String(),
+					constants.AnnotationForce,
+				),
+			))
+		}
+	}
+	return errs
+}
+
+// validateResourceQuotaName checks that the name of the managed resource quota is not changed.
+// The controller would leave the resource quotas of the old name behind.
+func validateResourceQuotaName(old, quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	if quota.GetResourceQuotaName() == old.GetResourceQuotaName() {
+		return nil
+	}
+	return field.ErrorList{field.Invalid(
+		field.NewPath("spec", "resourceQuotaName"),
+		quota.Spec.ResourceQuotaName,
+		"field is immutable",
+	)}
+}
+
+// validateOvercommit checks that the overcommit does not reduce the hard limits.
+func validateOvercommit(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	var errs field.ErrorList
+	for resourceName, percent := range quota.Spec.Overcommit {
+		if percent < 100 {
+			errs = append(errs, field.Invalid(
+				field.NewPath("spec", "overcommit", string(resourceName)),
+				percent,
+				"must be greater than or equal to 100",
+			))
+		}
+	}
+	return errs
+}
+
+// validateSchedules checks that the schedules replace only the resources limited by the tenant and have valid time zones.
+func validateSchedules(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	var errs field.ErrorList
+	for i, schedule := range quota.Spec.Schedules {
+		path := field.NewPath("spec", "schedules").Index(i)
+		if schedule.TimeZone != "" {
+			if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+				errs = append(errs, field.Invalid(path.Child("timeZone"), schedule.TimeZone, err.Error()))
+			}
+		}
+		for resourceName, quantity := range schedule.Hard {
+			if _, ok := quota.Spec.Hard[resourceName]; !ok {
+				errs = append(errs, field.Invalid(path.Child("hard", string(resourceName)), quantity.String(), "must be limited by the hard limits"))
+			}
+		}
+	}
+	return errs
+}
+
+// validateReclaim checks that the idle period of the reclaim policy is positive.
+// Reclamation is not combined with the Dynamic allocation policy, which already follows the usage.
+func validateReclaim(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	if quota.Spec.Reclaim == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if quota.Spec.Reclaim.IdlePeriod.Duration <= 0 {
+		errs = append(errs, field.Invalid(
+			field.NewPath("spec", "reclaim", "idlePeriod"),
+			quota.Spec.Reclaim.IdlePeriod.Duration.String(),
+			"must be greater than 0",
+		))
+	}
+	if quota.IsDynamic() {
+		errs = append(errs, field.Forbidden(
+			field.NewPath("spec", "reclaim"),
+			"reclaim is not supported with the Dynamic allocation policy",
+		))
+	}
+	return errs
+}
+
+// validateNamespaceWeights checks that the namespace weights are not negative.
+func validateNamespaceWeights(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	var errs field.ErrorList
+	for namespace, weight := range quota.Spec.NamespaceWeights {
+		if weight < 0 {
+			errs = append(errs, field.Invalid(
+				field.NewPath("spec", "namespaceWeights").Key(namespace),
+				weight,
+				"must be greater than or equal to 0",
+			))
+		}
+	}
+	return errs
+}
+
+// validateMissingResourceGracePeriod checks that the grace period for missing resources is not negative.
+func validateMissingResourceGracePeriod(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	gracePeriod := quota.Spec.MissingResourceGracePeriod
+	if gracePeriod == nil || gracePeriod.Duration >= 0 {
+		return nil
+	}
+	return field.ErrorList{field.Invalid(
+		field.NewPath("spec", "missingResourceGracePeriod"),
+		gracePeriod.Duration.String(),
+		"must be greater than or equal to 0",
+	)}
+}
+
+// validateResourceNameDuplicates checks that the hard limits do not mix the resource names treated as equivalent by resource quotas.
+func validateResourceNameDuplicates(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	errs := resourceNameDuplicateErrors(field.NewPath("spec", "hard"), quota.Spec.Hard)
+	for i, scopedQuota := range quota.Spec.ScopedQuotas {
+		errs = append(errs, resourceNameDuplicateErrors(field.NewPath("spec", "scopedQuotas").Index(i).Child("hard"), scopedQuota.Hard)...)
+	}
+	return errs
+}
+
+func resourceNameDuplicateErrors(path *field.Path, hard corev1.ResourceList) field.ErrorList {
+	var errs field.ErrorList
+	duplicates := resourcename.Duplicates(hard)
+	for _, resourceName := range duplicates {
+		var equivalents []string
+		for _, other := range duplicates {
+			if other != resourceName && resourcename.Equivalent(other, resourceName) {
+				equivalents = append(equivalents, string(other))
+			}
+		}
+		errs = append(errs, field.Forbidden(
+			path.Child(string(resourceName)),
+			fmt.Sprintf("mixed with equivalent resource names: %s", strings.Join(equivalents, ", ")),
+		))
+	}
+	return errs
+}
+
+// validateHardPatterns checks that the hard patterns are well-formed patterns of resource names.
+func validateHardPatterns(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	var errs field.ErrorList
+	for pattern := range quota.Spec.HardPatterns {
+		path := field.NewPath("spec", "hardPatterns", string(pattern))
+		if !resourcename.IsPattern(pattern) {
+			errs = append(errs, field.Invalid(path, pattern, "must be a pattern, use hard for a single resource"))
+			continue
+		}
+		if err := resourcename.ValidatePattern(pattern); err != nil {
+			errs = append(errs, field.Invalid(path, pattern, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateLeases checks that the leases raise only the resources limited by the tenant.
+func validateLeases(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	var errs field.ErrorList
+	for i, lease := range quota.Spec.Leases {
+		for resourceName, quantity := range lease.Hard {
+			path := field.NewPath("spec", "leases").Index(i).Child("hard", string(resourceName))
+			if _, ok := quota.Spec.Hard[resourceName]; !ok {
+				errs = append(errs, field.Invalid(path, quantity.String(), "must be limited by the hard limits"))
+				continue
+			}
+			if quantity.Sign() < 0 {
+				errs = append(errs, field.Invalid(path, quantity.String(), "must be greater than or equal to 0"))
+			}
+		}
+	}
+	return errs
+}
+
+// validateScopedQuotas checks that the scoped quotas do not take over the managed resource quota.
+func validateScopedQuotas(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	var errs field.ErrorList
+	for i, scopedQuota := range quota.Spec.ScopedQuotas {
+		if scopedQuota.Name == quota.GetResourceQuotaName() {
+			errs = append(errs, field.Invalid(
+				field.NewPath("spec", "scopedQuotas").Index(i).Child("name"),
+				scopedQuota.Name,
+				"must not be the name of the managed resource quota",
+			))
+		}
+		if len(scopedQuota.Scopes) == 0 && scopedQuota.ScopeSelector == nil {
+			errs = append(errs, field.Required(
+				field.NewPath("spec", "scopedQuotas").Index(i).Child("scopes"),
+				"scopes or scopeSelector is required",
+			))
+		}
+	}
+	return errs
+}
+
+// validateNamespaceDefaults checks that the namespace defaults and limits are consistent with the hard limits.
+func validateNamespaceDefaults(quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	var errs field.ErrorList
+	for resourceName, defaultHard := range quota.Spec.NamespaceDefaults {
+		if hard, ok := quota.Spec.Hard[resourceName]; ok && defaultHard.Cmp(hard) > 0 {
+			errs = append(errs, field.Invalid(
+				field.NewPath("spec", "namespaceDefaults", string(resourceName)),
+				defaultHard.String(),
+				fmt.Sprintf("must be less than or equal to the hard limit %s", hard.String()),
+			))
+		}
+	}
+
+	limits := quota.Spec.NamespaceLimits
+	if limits == nil {
+		return errs
+	}
+	for resourceName, minHard := range limits.Min {
+		if maxHard, ok := limits.Max[resourceName]; ok && minHard.Cmp(maxHard) > 0 {
+			errs = append(errs, field.Invalid(
+				field.NewPath("spec", "namespaceLimits", "min", string(resourceName)),
+				minHard.String(),
+				fmt.Sprintf("must be less than or equal to the maximum %s", maxHard.String()),
+			))
+		}
+	}
+	return errs
+}
+
+// validateNamespaceSelector checks that the selector is valid and the selected namespaces are not selected by other tenants.
+// Tenants with different priorities can select the same namespaces, and the one with the higher priority owns them.
+func (v *tenantResourceQuotaValidator) validateNamespaceSelector(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota) (field.ErrorList, error) {
+	selectorPath := field.NewPath("spec", "namespaceSelector")
+	selector, err := metav1.LabelSelectorAsSelector(quota.Spec.NamespaceSelector)
+	if err != nil {
+		return field.ErrorList{field.Invalid(selectorPath, quota.Spec.NamespaceSelector, err.Error())}, nil
+	}
+	if quota.Spec.NamespaceSelector == nil {
+		return nil, nil
+	}
+
+	var namespaces corev1.NamespaceList
+	err = v.reader.List(ctx, &namespaces, &client.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces.Items) == 0 {
+		return nil, nil
+	}
+
+	var quotas necotiatorv1beta1.TenantResourceQuotaList
+	err = v.reader.List(ctx, &quotas)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := make(map[string][]string)
+	for _, other := range quotas.Items {
+		if other.Name == quota.Name || other.Spec.Priority != quota.Spec.Priority {
+			continue
+		}
+		otherSelector, err := metav1.LabelSelectorAsSelector(other.Spec.NamespaceSelector)
+		if err != nil {
+			continue
+		}
+		for _, ns := range namespaces.Items {
+			if otherSelector.Matches(labels.Set(ns.Labels)) {
+				conflicts[other.Name] = append(conflicts[other.Name], ns.Name)
+			}
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+
+	tenants := make([]string, 0, len(conflicts))
+	for tenant := range conflicts {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	details := make([]string, 0, len(tenants))
+	for _, tenant := range tenants {
+		sort.Strings(conflicts[tenant])
+		details = append(details, fmt.Sprintf("%s (%s)", tenant, strings.Join(conflicts[tenant], ", ")))
+	}
+	return field.ErrorList{field.Forbidden(
+		selectorPath,
+		fmt.Sprintf("namespaces are already selected by other tenant resource quotas with the same priority: %s", strings.Join(details, ", ")),
+	)}, nil
+}
+
+// validateParent checks that the parent exists and the parent chain is not circular.
+func (v *tenantResourceQuotaValidator) validateParent(ctx context.Context, quota *necotiatorv1beta1.TenantResourceQuota) (field.ErrorList, error) {
+	parentPath := field.NewPath("spec", "parent")
+
+	visited := map[string]bool{quota.Name: true}
+	for parentName := quota.Spec.Parent; parentName != ""; {
+		if visited[parentName] {
+			return field.ErrorList{field.Invalid(parentPath, quota.Spec.Parent, "circular parent reference")}, nil
+		}
+		visited[parentName] = true
+
+		var parent necotiatorv1beta1.TenantResourceQuota
+		err := v.reader.Get(ctx, client.ObjectKey{Name: parentName}, &parent)
+		if apierrors.IsNotFound(err) {
+			return field.ErrorList{field.NotFound(parentPath, parentName)}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		parentName = parent.Spec.Parent
+	}
+	return nil, nil
+}
@@ -1,11 +1,15 @@
 package hooks
 
 import (
+	"fmt"
+	"time"
+
 	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
 	"github.com/cybozu-go/necotiator/pkg/constants"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -55,4 +59,381 @@ var _ = Describe("TenantResourceQuota Webhook Test", func() {
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(tenantResourceQuota.Finalizers).ShouldNot(ContainElement(constants.Finalizer))
 	})
+
+	It("should deny invalid namespace selector", func() {
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: newTestObjectName(),
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{
+							Key:      "team",
+							Operator: "Unknown",
+						},
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("spec.namespaceSelector: Invalid value")))
+	})
+
+	It("should deny namespace selector overlapping with other tenants", func() {
+		teamName := newTestObjectName()
+		namespaceName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+				Labels: map[string]string{
+					"team": teamName,
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		otherName := newTestObjectName()
+		other := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: otherName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"team": teamName,
+					},
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, other)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: newTestObjectName(),
+				},
+				Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{
+							{
+								Key:      "team",
+								Operator: metav1.LabelSelectorOpExists,
+							},
+						},
+					},
+				},
+			}
+			err = k8sClient.Create(ctx, tenantResourceQuota)
+			g.Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+			g.Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(fmt.Sprintf("%s (%s)", otherName, namespaceName))))
+		}).Should(Succeed())
+	})
+
+	It("should allow namespace selector overlapping with other tenants of different priority", func() {
+		teamName := newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: newTestObjectName(),
+				Labels: map[string]string{
+					"team": teamName,
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		newTenant := func(priority int32) *necotiatorv1beta1.TenantResourceQuota {
+			return &necotiatorv1beta1.TenantResourceQuota{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: newTestObjectName(),
+				},
+				Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"team": teamName,
+						},
+					},
+					Priority: priority,
+				},
+			}
+		}
+		err = k8sClient.Create(ctx, newTenant(0))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuota := newTenant(10)
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuota.Spec.Priority = 0
+		err = k8sClient.Update(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("namespaces are already selected by other tenant resource quotas with the same priority")))
+	})
+
+	It("should deny lowering hard limits below allocated resources unless forced", func() {
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: newTestObjectName(),
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuota.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
+			Allocated: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"limits.cpu": {
+					Total: resource.MustParse("500m"),
+				},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuota.Spec.Hard["limits.cpu"] = resource.MustParse("300m")
+		err = k8sClient.Update(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("hard limit is below the allocated resources: hard: limits.cpu=300m, allocated: limits.cpu=500m")))
+
+		tenantResourceQuota.Annotations = map[string]string{
+			constants.AnnotationForce: "true",
+		}
+		err = k8sClient.Update(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		By("checking later updates keeping the force annotation")
+		tenantResourceQuota.Spec.Hard["limits.cpu"] = resource.MustParse("200m")
+		err = k8sClient.Update(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("hard limit is below the allocated resources: hard: limits.cpu=200m, allocated: limits.cpu=500m")))
+	})
+
+	It("should deny changing resource quota name", func() {
+		tenantResourceQuotaName := newTestObjectName()
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuota.Spec.ResourceQuotaName = necotiatorv1beta1.DefaultResourceQuotaName
+		err = k8sClient.Update(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuota.Spec.ResourceQuotaName = "compute"
+		err = k8sClient.Update(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("spec.resourceQuotaName: Invalid value: \"compute\": field is immutable")))
+	})
+
+	It("should deny scoped quota named after the default resource quota", func() {
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: newTestObjectName(),
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				ScopedQuotas: []necotiatorv1beta1.ScopedQuota{
+					{
+						Name:   constants.ResourceQuotaNameDefault,
+						Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("spec.scopedQuotas[0].name: Invalid value")))
+	})
+
+	It("should deny lease of resource not limited by hard limits", func() {
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: newTestObjectName(),
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+				Leases: []necotiatorv1beta1.QuotaLease{
+					{
+						Name: "campaign",
+						Hard: corev1.ResourceList{
+							"limits.memory": resource.MustParse("1Gi"),
+						},
+						ExpiresAt: metav1.NewTime(time.Now().Add(time.Hour)),
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("spec.leases[0].hard.limits.memory: Invalid value")))
+	})
+
+	It("should deny schedule with unknown time zone", func() {
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: newTestObjectName(),
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu": resource.MustParse("1"),
+				},
+				Schedules: []necotiatorv1beta1.QuotaSchedule{
+					{
+						Name:     "night",
+						Start:    "20:00",
+						End:      "08:00",
+						TimeZone: "Unknown/Zone",
+						Hard: corev1.ResourceList{
+							"limits.cpu": resource.MustParse("2"),
+						},
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("spec.schedules[0].timeZone: Invalid value")))
+	})
+
+	It("should deny hard limits mixing equivalent resource names", func() {
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: newTestObjectName(),
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"cpu":          resource.MustParse("1"),
+					"requests.cpu": resource.MustParse("1"),
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("spec.hard.cpu: Forbidden: mixed with equivalent resource names: requests.cpu")))
+	})
+
+	It("should deny malformed hard patterns", func() {
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: newTestObjectName(),
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				HardPatterns: corev1.ResourceList{
+					"count/[":    resource.MustParse("10"),
+					"count/pods": resource.MustParse("10"),
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("spec.hardPatterns.count/[: Invalid value")))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("spec.hardPatterns.count/pods: Invalid value: \"count/pods\": must be a pattern, use hard for a single resource")))
+	})
+
+	It("should deny circular parent reference", func() {
+		parentName := newTestObjectName()
+		parent := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: parentName,
+			},
+		}
+		err := k8sClient.Create(ctx, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		childName := newTestObjectName()
+		child := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: childName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Parent: parentName,
+			},
+		}
+		err = k8sClient.Create(ctx, child)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: parentName}, parent)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			parent.Spec.Parent = childName
+			err = k8sClient.Update(ctx, parent)
+			g.Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+			g.Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("circular parent reference")))
+		}).Should(Succeed())
+	})
+
+	It("should deny missing parent", func() {
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: newTestObjectName(),
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Parent: newTestObjectName(),
+			},
+		}
+		err := k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring("spec.parent: Not found")))
+	})
+
+	It("should allow updating and deleting tenant resource quota after parent is deleted", func() {
+		parentName := newTestObjectName()
+		parent := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: parentName,
+			},
+		}
+		err := k8sClient.Create(ctx, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		childName := newTestObjectName()
+		Eventually(func() error {
+			child := &necotiatorv1beta1.TenantResourceQuota{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: childName,
+				},
+				Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+					Parent: parentName,
+				},
+			}
+			return k8sClient.Create(ctx, child)
+		}).Should(Succeed())
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: parentName}, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+		controllerutil.RemoveFinalizer(parent, constants.Finalizer)
+		err = k8sClient.Update(ctx, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+		err = k8sClient.Delete(ctx, parent)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		child := &necotiatorv1beta1.TenantResourceQuota{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: childName}, child)
+		Expect(err).ShouldNot(HaveOccurred())
+		child.Spec.Hard = corev1.ResourceList{
+			corev1.ResourceLimitsCPU: resource.MustParse("100m"),
+		}
+		err = k8sClient.Update(ctx, child)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = k8sClient.Delete(ctx, child)
+		Expect(err).ShouldNot(HaveOccurred())
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: childName}, child)
+		Expect(err).ShouldNot(HaveOccurred())
+		controllerutil.RemoveFinalizer(child, constants.Finalizer)
+		err = k8sClient.Update(ctx, child)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
 })
@@ -0,0 +1,276 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
+	"github.com/cybozu-go/necotiator/pkg/constants"
+)
+
+var usagelog = logf.Log.WithName("usage-resource")
+
+// usageValidator denies pods and persistent volume claims exceeding the hard limits of the tenant
+// based on the observed usage in the status of the tenant resource quota.
+type usageValidator struct {
+	client client.Client
+}
+
+// SetupUsageWebhookWithManager registers the webhooks for pods and persistent volume claims.
+// The handlers are registered without the webhook builder so that the validator can return admission warnings.
+func SetupUsageWebhookWithManager(mgr ctrl.Manager) error {
+	validator := &usageValidator{mgr.GetClient()}
+
+	podHook := admission.WithCustomValidator(&corev1.Pod{}, validator)
+	podHook.Handler = &warningHandler{Handler: podHook.Handler}
+	mgr.GetWebhookServer().Register("/validate--v1-pod", podHook)
+
+	pvcHook := admission.WithCustomValidator(&corev1.PersistentVolumeClaim{}, validator)
+	pvcHook.Handler = &warningHandler{Handler: pvcHook.Handler}
+	mgr.GetWebhookServer().Register("/validate--v1-persistentvolumeclaim", pvcHook)
+	return nil
+}
+
+// The failure policy is ignore so that pods of the system, including necotiator itself, can start while the webhook is down.
+// The namespace selector in the manifests limits the webhooks to the namespaces labeled by the controller as owned by tenants.
+//+kubebuilder:webhook:path=/validate--v1-pod,mutating=false,failurePolicy=ignore,sideEffects=None,groups=core,resources=pods,verbs=create,versions=v1,name=vpod.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate--v1-persistentvolumeclaim,mutating=false,failurePolicy=ignore,sideEffects=None,groups=core,resources=persistentvolumeclaims,verbs=create,versions=v1,name=vpersistentvolumeclaim.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomValidator = &usageValidator{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (v *usageValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	usagelog.Info("validate create")
+
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return v.validate(ctx, o, schema.GroupKind{Group: corev1.GroupName, Kind: "Pod"}, podUsage(o))
+	case *corev1.PersistentVolumeClaim:
+		return v.validate(ctx, o, schema.GroupKind{Group: corev1.GroupName, Kind: "PersistentVolumeClaim"}, persistentVolumeClaimUsage(o))
+	}
+	return fmt.Errorf("unknown obj type %T", obj)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (v *usageValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	return nil
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (v *usageValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *usageValidator) validate(ctx context.Context, obj client.Object, groupKind schema.GroupKind, usage corev1.ResourceList) error {
+	logger := log.FromContext(ctx)
+
+	tenantName, err := v.tenantOf(ctx, obj.GetNamespace())
+	if err != nil {
+		return err
+	}
+	if tenantName == "" {
+		return nil
+	}
+
+	var errs field.ErrorList
+	visited := make(map[string]bool)
+	for name := tenantName; name != ""; {
+		if visited[name] {
+			return fmt.Errorf("circular parent reference of tenant resource quota: %s", name)
+		}
+		visited[name] = true
+
+		var quota necotiatorv1beta1.TenantResourceQuota
+		err := v.client.Get(ctx, client.ObjectKey{Name: name}, &quota)
+		if err != nil {
+			return err
+		}
+		if quota.Spec.EnforceUsage {
+			errs = append(errs, enforceUsage(ctx, usage, &quota)...)
+		}
+		name = quota.Spec.Parent
+	}
+
+	if len(errs) > 0 {
+		err := apierrors.NewInvalid(groupKind, obj.GetName(), errs)
+		logger.Error(err, "validation error")
+		return err
+	}
+
+	return nil
+}
+
+// tenantOf returns the name of the tenant of the namespace from the labels of the managed resource quotas.
+func (v *usageValidator) tenantOf(ctx context.Context, namespace string) (string, error) {
+	var quotas corev1.ResourceQuotaList
+	err := v.client.List(ctx, &quotas, client.InNamespace(namespace), client.HasLabels{constants.LabelTenant})
+	if err != nil {
+		return "", err
+	}
+	for _, quota := range quotas.Items {
+		if tenant := quota.Labels[constants.LabelTenant]; tenant != "" {
+			return tenant, nil
+		}
+	}
+	return "", nil
+}
+
+// enforceUsage checks the usage against the tenant in the enforcement mode of the tenant.
+// The violations are returned as errors only in the Enforce mode.
+// The Warn mode adds them to the admission warnings, and the DryRun mode records them in the logs and the metrics.
+func enforceUsage(ctx context.Context, usage corev1.ResourceList, quota *necotiatorv1beta1.TenantResourceQuota) field.ErrorList {
+	violations := usageViolations(usage, quota)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	switch quota.Spec.EnforcementMode {
+	case necotiatorv1beta1.EnforcementWarn:
+		for _, violation := range violations {
+			addWarning(ctx, usageMessage(quota.Name, violation))
+		}
+		return nil
+	case necotiatorv1beta1.EnforcementDryRun:
+		request, err := admission.RequestFromContext(ctx)
+		dryRun := err == nil && request.DryRun != nil && *request.DryRun
+		for _, violation := range violations {
+			log.FromContext(ctx).Info("Allowed exceeding tenant usage in dry run mode", "tenant", quota.Name, "message", usageMessage(quota.Name, violation))
+			if !dryRun {
+				dryRunUsageViolationsTotal.WithLabelValues(quota.Name, string(violation.Resource)).Inc()
+			}
+		}
+		return nil
+	}
+
+	var errs field.ErrorList
+	for _, violation := range violations {
+		errs = append(errs, field.Forbidden(field.NewPath("spec"), usageMessage(quota.Name, violation)))
+	}
+	return errs
+}
+
+// usageViolations returns the resources of the usage making the observed usage of the tenant exceed the effective hard limits.
+func usageViolations(usage corev1.ResourceList, quota *necotiatorv1beta1.TenantResourceQuota) []necotiatorv1beta1.TenantLimitViolation {
+	hard := quota.EffectiveHard(time.Now())
+	var violations []necotiatorv1beta1.TenantLimitViolation
+	for resourceName, requested := range usage {
+		limit, ok := hard[resourceName]
+		if !ok || requested.IsZero() {
+			continue
+		}
+
+		newTotal := quota.Status.Used[resourceName].Total.DeepCopy()
+		newTotal.Add(requested)
+		if newTotal.Cmp(limit) > 0 {
+			violations = append(violations, necotiatorv1beta1.TenantLimitViolation{
+				Resource:  resourceName,
+				Requested: requested,
+				Total:     newTotal,
+				Hard:      limit,
+			})
+		}
+	}
+	return violations
+}
+
+// usageMessage returns the message reporting the violation of the hard limits of the tenant by the usage.
+func usageMessage(tenantName string, violation necotiatorv1beta1.TenantLimitViolation) string {
+	return fmt.Sprintf(
+		"exceeded tenant usage: %s, requested: %s=%s, total: %s=%s, limited: %s=%s",
+		tenantName,
+		violation.Resource, violation.Requested.String(),
+		violation.Resource, violation.Total.String(),
+		violation.Resource, violation.Hard.String(),
+	)
+}
+
+// podUsage returns the resources of the pod in the names of resource quota.
+// Init containers run before the containers, so the larger of them is counted.
+func podUsage(pod *corev1.Pod) corev1.ResourceList {
+	requests := make(corev1.ResourceList)
+	limits := make(corev1.ResourceList)
+	for _, container := range pod.Spec.Containers {
+		addResources(requests, container.Resources.Requests)
+		addResources(limits, container.Resources.Limits)
+	}
+	for _, container := range pod.Spec.InitContainers {
+		maxResources(requests, container.Resources.Requests)
+		maxResources(limits, container.Resources.Limits)
+	}
+	addResources(requests, pod.Spec.Overhead)
+	addResources(limits, pod.Spec.Overhead)
+
+	usage := corev1.ResourceList{
+		corev1.ResourcePods: resource.MustParse("1"),
+		"count/pods":        resource.MustParse("1"),
+	}
+	for resourceName, quantity := range requests {
+		usage[resourceName] = quantity
+		usage[corev1.DefaultResourceRequestsPrefix+resourceName] = quantity
+	}
+	for resourceName, quantity := range limits {
+		usage["limits."+resourceName] = quantity
+	}
+	return usage
+}
+
+// persistentVolumeClaimUsage returns the resources of the persistent volume claim in the names of resource quota.
+func persistentVolumeClaimUsage(pvc *corev1.PersistentVolumeClaim) corev1.ResourceList {
+	storage := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	usage := corev1.ResourceList{
+		corev1.ResourcePersistentVolumeClaims: resource.MustParse("1"),
+		"count/persistentvolumeclaims":        resource.MustParse("1"),
+		corev1.ResourceRequestsStorage:        storage,
+	}
+	if pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != "" {
+		prefix := *pvc.Spec.StorageClassName + ".storageclass.storage.k8s.io/"
+		usage[corev1.ResourceName(prefix+string(corev1.ResourcePersistentVolumeClaims))] = resource.MustParse("1")
+		usage[corev1.ResourceName(prefix+string(corev1.ResourceRequestsStorage))] = storage
+	}
+	return usage
+}
+
+func addResources(total, resources corev1.ResourceList) {
+	for resourceName, quantity := range resources {
+		current := total[resourceName]
+		current.Add(quantity)
+		total[resourceName] = current
+	}
+}
+
+func maxResources(total, resources corev1.ResourceList) {
+	for resourceName, quantity := range resources {
+		if current, ok := total[resourceName]; !ok || quantity.Cmp(current) > 0 {
+			total[resourceName] = quantity.DeepCopy()
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package hooks
+
+import (
+	"fmt"
+
+	necotiatorv1beta1 "github.com/cybozu-go/necotiator/api/v1beta1"
+	"github.com/cybozu-go/necotiator/pkg/constants"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Usage Webhook Test", func() {
+	var namespaceName string
+	var tenantResourceQuotaName string
+
+	newPod := func(cpu string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      newTestObjectName(),
+				Namespace: namespaceName,
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "main",
+						Image: "busybox",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								"cpu": resource.MustParse(cpu),
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		namespaceName = newTestObjectName()
+		tenantResourceQuotaName = newTestObjectName()
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+				Labels: map[string]string{
+					constants.LabelTenant: tenantResourceQuotaName,
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: tenantResourceQuotaName,
+			},
+			Spec: necotiatorv1beta1.TenantResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"requests.cpu":     resource.MustParse("1"),
+					"requests.storage": resource.MustParse("10Gi"),
+				},
+				Overcommit: map[corev1.ResourceName]int32{
+					"requests.cpu":     200,
+					"requests.storage": 200,
+				},
+				EnforceUsage: true,
+			},
+		}
+		err = k8sClient.Create(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		tenantResourceQuota.Status = necotiatorv1beta1.TenantResourceQuotaStatus{
+			Used: map[corev1.ResourceName]necotiatorv1beta1.ResourceUsage{
+				"requests.cpu": {
+					Total: resource.MustParse("900m"),
+				},
+				"requests.storage": {
+					Total: resource.MustParse("9Gi"),
+				},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		resourceQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.ResourceQuotaNameDefault,
+				Namespace: namespaceName,
+				Labels: map[string]string{
+					constants.LabelCreatedBy: constants.CreatedBy,
+					constants.LabelTenant:    tenantResourceQuotaName,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"requests.cpu":     resource.MustParse("1"),
+					"requests.storage": resource.MustParse("10Gi"),
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		resourceQuota.Status = corev1.ResourceQuotaStatus{
+			Hard: resourceQuota.Spec.Hard,
+			Used: corev1.ResourceList{
+				"requests.cpu":     resource.MustParse("0"),
+				"requests.storage": resource.MustParse("0"),
+			},
+		}
+		err = k8sClient.Status().Update(ctx, resourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should allow pod within tenant usage", func() {
+		err := k8sClient.Create(ctx, newPod("100m"))
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should deny pod exceeding tenant usage", func() {
+		err := k8sClient.Create(ctx, newPod("200m"))
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(fmt.Sprintf("exceeded tenant usage: %s, requested: requests.cpu=200m, total: requests.cpu=1100m, limited: requests.cpu=1", tenantResourceQuotaName))))
+	})
+
+	It("should deny persistent volume claim exceeding tenant usage", func() {
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      newTestObjectName(),
+				Namespace: namespaceName,
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("2Gi"),
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, pvc)
+		Expect(err).Should(HaveStatusErrorReason(Equal(metav1.StatusReasonInvalid)))
+		Expect(err).Should(HaveStatusErrorMessage(ContainSubstring(fmt.Sprintf("exceeded tenant usage: %s, requested: requests.storage=2Gi, total: requests.storage=11Gi, limited: requests.storage=10Gi", tenantResourceQuotaName))))
+	})
+
+	It("should warn pod exceeding tenant usage in Warn mode", func() {
+		tenantResourceQuota := &necotiatorv1beta1.TenantResourceQuota{}
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: tenantResourceQuotaName}, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+		tenantResourceQuota.Spec.EnforcementMode = necotiatorv1beta1.EnforcementWarn
+		err = k8sClient.Update(ctx, tenantResourceQuota)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		warnings := &warningRecorder{}
+		warningCfg := rest.CopyConfig(cfg)
+		warningCfg.WarningHandler = warnings
+		warningClient, err := client.New(warningCfg, client.Options{Scheme: k8sClient.Scheme()})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			warnings.messages = nil
+			err := warningClient.Create(ctx, newPod("200m"))
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(warnings.messages).Should(ContainElement(ContainSubstring(fmt.Sprintf("exceeded tenant usage: %s, requested: requests.cpu=200m", tenantResourceQuotaName))))
+		}).Should(Succeed())
+	})
+})
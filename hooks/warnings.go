@@ -0,0 +1,53 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type warningsKey struct{}
+
+// warningHandler returns the warnings added by the wrapped handler in the admission response.
+// admission.CustomValidator cannot return warnings by itself.
+type warningHandler struct {
+	admission.Handler
+}
+
+var _ admission.DecoderInjector = &warningHandler{}
+
+// InjectDecoder injects the decoder into the wrapped handler.
+func (h *warningHandler) InjectDecoder(d *admission.Decoder) error {
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
+
+// Handle calls the wrapped handler and adds the warnings to the response.
+func (h *warningHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var warnings []string
+	resp := h.Handler.Handle(context.WithValue(ctx, warningsKey{}, &warnings), req)
+	return resp.WithWarnings(warnings...)
+}
+
+// addWarning adds the admission warning to the response of the request.
+func addWarning(ctx context.Context, warning string) {
+	if warnings, ok := ctx.Value(warningsKey{}).(*[]string); ok {
+		*warnings = append(*warnings, warning)
+	}
+}
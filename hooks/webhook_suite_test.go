@@ -89,12 +89,17 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = SetupResourceQuotaWebhookWithManager(mgr, "necotiator-system", "necotiator-controller-manager")
+	err = SetupResourceQuotaWebhookWithManager(mgr, "necotiator-system", "necotiator-controller-manager", []string{"necotiator:quota-deleters"}, BypassIdentities{
+		Users: []string{"migration-tool"},
+	}, false)
 	Expect(err).NotTo(HaveOccurred())
 
 	err = SetupTenantResourceQuotaWebhookWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = SetupUsageWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:webhook
 
 	go func() {
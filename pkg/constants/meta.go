@@ -12,6 +12,12 @@ const (
 	LabelCreatedBy = "app.kubernetes.io/created-by"
 )
 
+// Annotations
+const (
+	AnnotationForce         = MetaPrefix + "force"
+	AnnotationAppliedLeases = MetaPrefix + "applied-leases"
+)
+
 // Label or annotation values
 const (
 	CreatedBy                = "necotiator"
@@ -0,0 +1,49 @@
+// Package fieldowner inspects the field managers of the hard limits of resource quotas.
+package fieldowner
+
+import (
+	"bytes"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// HardPath returns the field path of the hard limit of the resource.
+func HardPath(resourceName corev1.ResourceName) fieldpath.Path {
+	return fieldpath.MakePathOrDie("spec", "hard", string(resourceName))
+}
+
+// HardOwners returns the sorted field managers owning the hard limit of each resource in the resource quota.
+// Resources without managed fields are omitted.
+func HardOwners(rq *corev1.ResourceQuota) (map[corev1.ResourceName][]string, error) {
+	owners := make(map[corev1.ResourceName][]string)
+	for _, managedField := range rq.GetManagedFields() {
+		if managedField.FieldsV1 == nil {
+			continue
+		}
+		fs := &fieldpath.Set{}
+		err := fs.FromJSON(bytes.NewReader(managedField.FieldsV1.Raw))
+		if err != nil {
+			return nil, err
+		}
+		for resourceName := range rq.Spec.Hard {
+			if fs.Has(HardPath(resourceName)) && !contains(owners[resourceName], managedField.Manager) {
+				owners[resourceName] = append(owners[resourceName], managedField.Manager)
+			}
+		}
+	}
+	for resourceName := range owners {
+		sort.Strings(owners[resourceName])
+	}
+	return owners, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+// Package resourcename normalizes the names of resources treated as equivalent by resource quotas.
+//
+// Resource quotas track the requests of cpu, memory, ephemeral-storage and huge pages under both the bare name
+// and the name with the "requests." prefix, for example cpu and requests.cpu.
+// The object counts of some core resources are tracked under both the bare name and the name with the "count/" prefix,
+// for example pods and count/pods.
+//
+// It also matches resource names with patterns in the syntax of path.Match, such as count/*,
+// to limit the total of all matching resources.
+package resourcename
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// objectCountPrefix is the prefix of the names of object counts.
+const objectCountPrefix = "count/"
+
+// Normalize returns the canonical name of the resource.
+// Resources with an equivalent bare name are normalized to the name with the "requests." prefix,
+// and object counts with an equivalent bare name to the name with the "count/" prefix.
+func Normalize(name corev1.ResourceName) corev1.ResourceName {
+	switch name {
+	case corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
+		return corev1.DefaultResourceRequestsPrefix + name
+	case corev1.ResourcePods, corev1.ResourceServices, corev1.ResourceSecrets, corev1.ResourceConfigMaps,
+		corev1.ResourcePersistentVolumeClaims, corev1.ResourceReplicationControllers, corev1.ResourceQuotas:
+		return objectCountPrefix + name
+	}
+	if strings.HasPrefix(string(name), corev1.ResourceHugePagesPrefix) {
+		return corev1.DefaultResourceRequestsPrefix + name
+	}
+	return name
+}
+
+// Equivalent returns true if resource quotas treat the resources as the same.
+func Equivalent(a, b corev1.ResourceName) bool {
+	return Normalize(a) == Normalize(b)
+}
+
+// Lookup returns the name in the resource list equivalent to the name.
+func Lookup(list corev1.ResourceList, name corev1.ResourceName) (corev1.ResourceName, bool) {
+	if _, ok := list[name]; ok {
+		return name, true
+	}
+	for listed := range list {
+		if Equivalent(listed, name) {
+			return listed, true
+		}
+	}
+	return "", false
+}
+
+// Translate returns the resource list whose names are replaced with the equivalent ones in names.
+// Names without equivalents in names are kept as they are.
+// If the resource list has equivalent names, the smaller quantity is taken since resource quotas enforce both of them.
+func Translate(list, names corev1.ResourceList) corev1.ResourceList {
+	if list == nil {
+		return nil
+	}
+	translated := make(corev1.ResourceList, len(list))
+	for name, quantity := range list {
+		if equivalent, ok := Lookup(names, name); ok {
+			name = equivalent
+		}
+		if current, ok := translated[name]; ok && current.Cmp(quantity) <= 0 {
+			continue
+		}
+		translated[name] = quantity
+	}
+	return translated
+}
+
+// Duplicates returns the sorted names in the resource list that have other equivalent names in the list.
+func Duplicates(list corev1.ResourceList) []corev1.ResourceName {
+	counts := make(map[corev1.ResourceName]int)
+	for name := range list {
+		counts[Normalize(name)]++
+	}
+	var duplicates []corev1.ResourceName
+	for name := range list {
+		if counts[Normalize(name)] > 1 {
+			duplicates = append(duplicates, name)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i] < duplicates[j] })
+	return duplicates
+}
+
+// IsPattern returns true if the name has any of the special characters of path.Match.
+func IsPattern(name corev1.ResourceName) bool {
+	return strings.ContainsAny(string(name), `*?[\`)
+}
+
+// ValidatePattern returns path.ErrBadPattern if the pattern is malformed.
+func ValidatePattern(pattern corev1.ResourceName) error {
+	_, err := path.Match(string(pattern), "")
+	return err
+}
+
+// Match returns true if the resource name matches the pattern.
+// The normalized name is matched as well, so that requests.* matches cpu. Patterns never match patterns.
+func Match(pattern, name corev1.ResourceName) bool {
+	if IsPattern(name) {
+		return false
+	}
+	if ok, _ := path.Match(string(pattern), string(name)); ok {
+		return true
+	}
+	ok, _ := path.Match(string(pattern), string(Normalize(name)))
+	return ok
+}
+
+// Patterns returns the sorted patterns in the resource list matching the resource name.
+func Patterns(list corev1.ResourceList, name corev1.ResourceName) []corev1.ResourceName {
+	var patterns []corev1.ResourceName
+	for pattern := range list {
+		if IsPattern(pattern) && Match(pattern, name) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i] < patterns[j] })
+	return patterns
+}
+
+// Expand returns the sorted names in candidates matching any of the patterns in the resource list.
+func Expand(list corev1.ResourceList, candidates []corev1.ResourceName) []corev1.ResourceName {
+	seen := make(map[corev1.ResourceName]bool)
+	var expanded []corev1.ResourceName
+	for _, name := range candidates {
+		if seen[name] || len(Patterns(list, name)) == 0 {
+			continue
+		}
+		seen[name] = true
+		expanded = append(expanded, name)
+	}
+	sort.Slice(expanded, func(i, j int) bool { return expanded[i] < expanded[j] })
+	return expanded
+}
+
+// Totals returns the total quantity of the resources in the resource list matching each pattern in patterns.
+// Names in patterns other than patterns are ignored, and patterns without matching resources have zero.
+// Equivalent resources are counted once with the smaller quantity since resource quotas enforce both of them.
+func Totals(list, patterns corev1.ResourceList) corev1.ResourceList {
+	var totals corev1.ResourceList
+	for pattern := range patterns {
+		if !IsPattern(pattern) {
+			continue
+		}
+		matched := make(corev1.ResourceList)
+		for name, quantity := range list {
+			if !Match(pattern, name) {
+				continue
+			}
+			normalized := Normalize(name)
+			if current, ok := matched[normalized]; ok && current.Cmp(quantity) <= 0 {
+				continue
+			}
+			matched[normalized] = quantity
+		}
+		total := resource.MustParse("0")
+		for _, quantity := range matched {
+			total.Add(quantity)
+		}
+		if totals == nil {
+			totals = make(corev1.ResourceList)
+		}
+		totals[pattern] = total
+	}
+	return totals
+}
+
+// WithTotals returns a copy of the resource list with the totals of the patterns in patterns added.
+func WithTotals(list, patterns corev1.ResourceList) corev1.ResourceList {
+	totals := Totals(list, patterns)
+	if len(totals) == 0 {
+		return list
+	}
+	withTotals := make(corev1.ResourceList, len(list)+len(totals))
+	for name, quantity := range list {
+		withTotals[name] = quantity
+	}
+	for pattern, total := range totals {
+		withTotals[pattern] = total
+	}
+	return withTotals
+}
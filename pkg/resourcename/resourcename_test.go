@@ -0,0 +1,134 @@
+package resourcename
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("Resource name normalization", func() {
+	DescribeTable("equivalent resource names", func(bare, prefixed corev1.ResourceName) {
+		Expect(Normalize(bare)).Should(Equal(prefixed))
+		Expect(Normalize(prefixed)).Should(Equal(prefixed))
+		Expect(Equivalent(bare, prefixed)).Should(BeTrue())
+		Expect(Equivalent(prefixed, bare)).Should(BeTrue())
+
+		Expect(Translate(corev1.ResourceList{bare: resource.MustParse("1")}, corev1.ResourceList{prefixed: resource.MustParse("2")})).Should(Equal(corev1.ResourceList{
+			prefixed: resource.MustParse("1"),
+		}))
+		Expect(Translate(corev1.ResourceList{prefixed: resource.MustParse("1")}, corev1.ResourceList{bare: resource.MustParse("2")})).Should(Equal(corev1.ResourceList{
+			bare: resource.MustParse("1"),
+		}))
+		Expect(Duplicates(corev1.ResourceList{bare: resource.MustParse("1"), prefixed: resource.MustParse("1")})).Should(ConsistOf(bare, prefixed))
+	},
+		Entry("cpu", corev1.ResourceCPU, corev1.ResourceRequestsCPU),
+		Entry("memory", corev1.ResourceMemory, corev1.ResourceRequestsMemory),
+		Entry("ephemeral-storage", corev1.ResourceEphemeralStorage, corev1.ResourceRequestsEphemeralStorage),
+		Entry("hugepages-2Mi", corev1.ResourceName("hugepages-2Mi"), corev1.ResourceName("requests.hugepages-2Mi")),
+		Entry("hugepages-1Gi", corev1.ResourceName("hugepages-1Gi"), corev1.ResourceName("requests.hugepages-1Gi")),
+		Entry("pods", corev1.ResourcePods, corev1.ResourceName("count/pods")),
+		Entry("services", corev1.ResourceServices, corev1.ResourceName("count/services")),
+		Entry("secrets", corev1.ResourceSecrets, corev1.ResourceName("count/secrets")),
+		Entry("configmaps", corev1.ResourceConfigMaps, corev1.ResourceName("count/configmaps")),
+		Entry("persistentvolumeclaims", corev1.ResourcePersistentVolumeClaims, corev1.ResourceName("count/persistentvolumeclaims")),
+		Entry("replicationcontrollers", corev1.ResourceReplicationControllers, corev1.ResourceName("count/replicationcontrollers")),
+		Entry("resourcequotas", corev1.ResourceQuotas, corev1.ResourceName("count/resourcequotas")),
+	)
+
+	DescribeTable("resource names without equivalents", func(name corev1.ResourceName) {
+		Expect(Normalize(name)).Should(Equal(name))
+		Expect(Duplicates(corev1.ResourceList{name: resource.MustParse("1")})).Should(BeEmpty())
+	},
+		Entry("limits.cpu", corev1.ResourceLimitsCPU),
+		Entry("limits.memory", corev1.ResourceLimitsMemory),
+		Entry("limits.ephemeral-storage", corev1.ResourceLimitsEphemeralStorage),
+		Entry("requests.storage", corev1.ResourceRequestsStorage),
+		Entry("storage", corev1.ResourceStorage),
+		Entry("services.loadbalancers", corev1.ResourceServicesLoadBalancers),
+		Entry("count/deployments.apps", corev1.ResourceName("count/deployments.apps")),
+		Entry("requests.nvidia.com/gpu", corev1.ResourceName("requests.nvidia.com/gpu")),
+	)
+
+	It("should not treat limits as equivalent to requests", func() {
+		Expect(Equivalent(corev1.ResourceLimitsCPU, corev1.ResourceCPU)).Should(BeFalse())
+		Expect(Equivalent(corev1.ResourceLimitsCPU, corev1.ResourceRequestsCPU)).Should(BeFalse())
+	})
+
+	It("should take the smaller quantity of equivalent names", func() {
+		translated := Translate(corev1.ResourceList{
+			corev1.ResourceCPU:         resource.MustParse("200m"),
+			corev1.ResourceRequestsCPU: resource.MustParse("100m"),
+			corev1.ResourceLimitsCPU:   resource.MustParse("300m"),
+		}, corev1.ResourceList{
+			corev1.ResourceRequestsCPU: resource.MustParse("1"),
+		})
+		Expect(translated).Should(Equal(corev1.ResourceList{
+			corev1.ResourceRequestsCPU: resource.MustParse("100m"),
+			corev1.ResourceLimitsCPU:   resource.MustParse("300m"),
+		}))
+	})
+})
+
+var _ = Describe("Resource name patterns", func() {
+	DescribeTable("matching resource names", func(pattern, name corev1.ResourceName, matched bool) {
+		Expect(IsPattern(pattern)).Should(BeTrue())
+		Expect(ValidatePattern(pattern)).Should(Succeed())
+		Expect(Match(pattern, name)).Should(Equal(matched))
+	},
+		Entry("storage class", corev1.ResourceName("*.storageclass.storage.k8s.io/requests.storage"), corev1.ResourceName("gold.storageclass.storage.k8s.io/requests.storage"), true),
+		Entry("other resource of storage class", corev1.ResourceName("*.storageclass.storage.k8s.io/requests.storage"), corev1.ResourceName("gold.storageclass.storage.k8s.io/persistentvolumeclaims"), false),
+		Entry("object count", corev1.ResourceName("count/*"), corev1.ResourceName("count/deployments.apps"), true),
+		Entry("object count of core group", corev1.ResourceName("count/*"), corev1.ResourceName("count/pods"), true),
+		Entry("extended resource", corev1.ResourceName("requests.nvidia.com/*"), corev1.ResourceName("requests.nvidia.com/gpu"), true),
+		Entry("normalized name", corev1.ResourceName("requests.*"), corev1.ResourceCPU, true),
+		Entry("normalized object count", corev1.ResourceName("count/*"), corev1.ResourcePods, true),
+		Entry("pattern", corev1.ResourceName("count/*"), corev1.ResourceName("count/*"), false),
+	)
+
+	It("should reject malformed patterns", func() {
+		Expect(ValidatePattern("count/[")).ShouldNot(Succeed())
+		Expect(IsPattern(corev1.ResourceRequestsCPU)).Should(BeFalse())
+	})
+
+	It("should expand patterns into matching names", func() {
+		expanded := Expand(corev1.ResourceList{
+			"*.storageclass.storage.k8s.io/requests.storage": resource.MustParse("10Gi"),
+			"count/*": resource.MustParse("100"),
+		}, []corev1.ResourceName{
+			"silver.storageclass.storage.k8s.io/requests.storage",
+			"gold.storageclass.storage.k8s.io/requests.storage",
+			"gold.storageclass.storage.k8s.io/persistentvolumeclaims",
+			"count/pods",
+			"count/pods",
+			corev1.ResourceRequestsCPU,
+		})
+		Expect(expanded).Should(Equal([]corev1.ResourceName{
+			"count/pods",
+			"gold.storageclass.storage.k8s.io/requests.storage",
+			"silver.storageclass.storage.k8s.io/requests.storage",
+		}))
+	})
+
+	It("should total matching resources for each pattern", func() {
+		totals := WithTotals(corev1.ResourceList{
+			"gold.storageclass.storage.k8s.io/requests.storage":   resource.MustParse("3Gi"),
+			"silver.storageclass.storage.k8s.io/requests.storage": resource.MustParse("2Gi"),
+			corev1.ResourceCPU:         resource.MustParse("200m"),
+			corev1.ResourceRequestsCPU: resource.MustParse("100m"),
+		}, corev1.ResourceList{
+			"*.storageclass.storage.k8s.io/requests.storage": resource.MustParse("10Gi"),
+			"requests.*":               resource.MustParse("1"),
+			"count/*":                  resource.MustParse("100"),
+			corev1.ResourceRequestsCPU: resource.MustParse("1"),
+		})
+		Expect(totals).Should(HaveLen(7))
+		Expect(totals).Should(HaveKeyWithValue(corev1.ResourceName("*.storageclass.storage.k8s.io/requests.storage"), WithTransform(quantityString, Equal("5Gi"))))
+		Expect(totals).Should(HaveKeyWithValue(corev1.ResourceName("requests.*"), WithTransform(quantityString, Equal("100m"))))
+		Expect(totals).Should(HaveKeyWithValue(corev1.ResourceName("count/*"), WithTransform(quantityString, Equal("0"))))
+	})
+})
+
+func quantityString(q resource.Quantity) string {
+	return q.String()
+}
@@ -0,0 +1,13 @@
+package resourcename
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestResourceName(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ResourceName Suite", Label("envtest", "resourcename"))
+}